@@ -2,170 +2,106 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
-	"flag"
 	"fmt"
-	"github.com/ably/ably-go/ably"
-	"github.com/google/uuid"
-	"io"
-	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"the-quiz-game/pkg/config"
+	"the-quiz-game/pkg/events"
+	"the-quiz-game/pkg/protocol"
+	quizClient "the-quiz-game/pkg/quiz-client"
+	"time"
 )
 
-// Client holds the ablyClient and servers url
-type Client struct {
-	ablyClient *ably.Realtime
-	serverURL  string
-}
+// handleEvent prints a verified session event to the console. The quiz-end event cancels
+// the session context so the client can exit.
+func handleEvent(event quizClient.Event, cancel context.CancelFunc) {
+	switch payload := event.Payload.(type) {
+	case *events.QuizStartingPayload:
+		fmt.Println(payload.Message)
 
-// NewClient initializes a new Client. It establishes a connection to the Ably service
-// and returns an instance of Client or an error.
-func NewClient(serverURL, ablyKey string) (*Client, error) {
-	realtime, err := ably.NewRealtime(ably.WithKey(ablyKey))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Ably realtime client: %w", err)
-	}
-	return &Client{
-		ablyClient: realtime,
-		serverURL:  serverURL,
-	}, nil
-}
+	case *events.QuestionPayload:
+		// Display the question and answers.
+		displayQuestionAndAnswers(*payload)
 
-// ConnectToSession sends a request to join a gaming session. It accepts the player's name
-// and ID, and if successful, returns the session ID of the new session.
-func (c *Client) ConnectToSession(playerName, playerId string) (string, error) {
-	data := map[string]string{
-		"playerName": playerName,
-		"playerId":   playerId,
-	}
-	body, err := json.Marshal(data)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal JSON: %w", err)
+	case *events.ResumedPayload:
+		fmt.Println(payload.Message)
+
+	case *events.AnswerCountPayload:
+		fmt.Printf("%d of %d players answered.\n", payload.Answered, payload.Players)
+
+	case *events.StandingsPayload:
+		displayStandings(*payload)
+
+	case *events.ScoreboardPayload:
+		fmt.Println("Scoreboard:")
+		for _, entry := range payload.Rankings {
+			fmt.Printf("%d. %s: %d (%d correct, %s average)\n", entry.Rank, entry.Name, entry.Score, entry.CorrectAnswers, averageResponseTime(entry))
+		}
+
+	case *events.QuizEndPayload:
+		fmt.Println("Quiz has ended.", payload.Message)
+		// This informs the parent function that it can terminate or clean up as needed.
+		cancel()
 	}
+}
 
-	// Send a request to the server to join a session.
-	resp, err := http.Post(c.serverURL+"/connect-to-session", "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+// displayQuestionAndAnswers outputs the question and possible answers to the console.
+func displayQuestionAndAnswers(qm events.QuestionPayload) {
+	fmt.Println("New question: ", qm.Question)
+	fmt.Println("Select an answer from the following options:")
+	for i, answer := range qm.PossibleAnswers {
+		fmt.Printf("%d: %s\n", i+1, answer)
 	}
-	defer resp.Body.Close()
+	fmt.Printf("You have %d seconds to answer.\n", int(time.Until(qm.Deadline).Round(time.Second).Seconds()))
+}
 
-	// Decode the response to retrieve the session ID.
-	var response struct {
-		SessionId string `json:"sessionId"`
+// displayStandings outputs the standings after a question, with how each player's rank changed.
+func displayStandings(standings events.StandingsPayload) {
+	if standings.Hidden {
+		fmt.Println("Standings are hidden until the end of the quiz.")
+		return
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	fmt.Println("Standings:")
+	for _, standing := range standings.Standings {
+		fmt.Printf("%d. %s %d (+%d) %s%s\n", standing.Rank, standing.Name, standing.Score, standing.Delta, rankChange(standing), streak(standing))
 	}
-
-	// Return the session ID received from the server.
-	return response.SessionId, nil
 }
 
-// QuestionMessage represents the structure of a message containing a question and answers.
-type QuestionMessage struct {
-	Question string   `json:"question"`
-	Answers  []string `json:"possibleAnswers"`
+// rankChange describes how a player's rank changed since the previous standings.
+func rankChange(standing events.Standing) string {
+	switch {
+	case standing.PreviousRank == 0 || standing.PreviousRank == standing.Rank:
+		return "="
+	case standing.PreviousRank > standing.Rank:
+		return fmt.Sprintf("▲%d", standing.PreviousRank-standing.Rank)
+	default:
+		return fmt.Sprintf("▼%d", standing.Rank-standing.PreviousRank)
+	}
 }
 
-// ListenToAblyChannel subscribes to a specific Ably channel, and listens for messages.
-// new_question, quiz-update, and quiz-end messages are handled.
-func (c *Client) ListenToAblyChannel(ctx context.Context, channelName string, cancel context.CancelFunc) {
-	channel := c.ablyClient.Channels.Get(channelName)
-	// Subscribe to messages on the channel.
-	_, err := channel.SubscribeAll(ctx, func(msg *ably.Message) {
-		// Handle the message based on its name.
-		switch msg.Name {
-		case "new_question":
-			var questionMsg QuestionMessage
-			jsonData, ok := msg.Data.(string) // Asserting that Data is a string.
-			if !ok {
-				fmt.Println("Error: expected string data in message")
-				return
-			}
-			err := json.Unmarshal([]byte(jsonData), &questionMsg)
-			if err != nil {
-				fmt.Printf("Error unmarshalling JSON: %s\n", err)
-				return
-			}
-			// Display the question and answers.
-			c.displayQuestionAndAnswers(questionMsg)
-
-		case "quiz-update":
-			// Further actions can be taken here based on quiz updates.
-			fmt.Println(msg.Data)
-
-		case "quiz-end":
-			fmt.Println("Quiz has ended.")
-			// This informs the parent function that it can terminate or clean up as needed.
-			cancel()
-			return
+func averageResponseTime(entry events.ScoreboardEntry) string {
+	return (time.Duration(entry.AverageResponseTimeMs) * time.Millisecond).Round(100 * time.Millisecond).String()
+}
 
-		}
-	})
-	if err != nil {
-		fmt.Printf("Error subscribing to channel: %v\n", err)
-		return
+func streak(standing events.Standing) string {
+	if standing.Streak < 2 {
+		return ""
 	}
-
+	return fmt.Sprintf(" streak %d", standing.Streak)
 }
 
-// SubmitAnswer sends the player's answer to the server.
-func (c *Client) SubmitAnswer(sessionId, playerId, answer string) error {
-	// Convert the answer to an integer.
+// parseAnswer converts the 1-based answer typed by the player to the zero-based index the server expects.
+func parseAnswer(answer string) (int, error) {
 	answerInt, err := strconv.Atoi(answer)
 	if err != nil {
-		return fmt.Errorf("error converting answer to integer: %w", err)
+		return 0, fmt.Errorf("error converting answer to integer: %w", err)
 	}
 	if answerInt < 1 {
-		return fmt.Errorf("answer must be value of 1 or higher")
-	}
-	answerInt-- // Subtract 1 to convert to zero-based index.
-
-	requestPayload := struct {
-		SessionId string `json:"sessionId"`
-		PlayerId  string `json:"playerId"`
-		Answer    int    `json:"answer"`
-	}{
-		SessionId: sessionId,
-		PlayerId:  playerId,
-		Answer:    answerInt,
-	}
-	body, err := json.Marshal(requestPayload)
-	if err != nil {
-		return fmt.Errorf("error marshalling JSON: %w", err)
-	}
-
-	// Send the answer to the server.
-	resp, err := http.Post(c.serverURL+"/submit-answer", "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return fmt.Errorf("error sending request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Handle non-OK responses.
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("error reading response body: %w", err)
-		}
-		return fmt.Errorf("error submitting answer: %s", string(bodyBytes))
-	}
-
-	return nil
-}
-
-// displayQuestionAndAnswers outputs the question and possible answers to the console.
-func (c *Client) displayQuestionAndAnswers(qm QuestionMessage) {
-	fmt.Println("New question: ", qm.Question)
-	fmt.Println("Select an answer from the following options:")
-	for i, answer := range qm.Answers {
-		fmt.Printf("%d: %s\n", i+1, answer)
+		return 0, fmt.Errorf("answer must be value of 1 or higher")
 	}
+	return answerInt - 1, nil
 }
 
 func getUserInput(reader *bufio.Reader) (string, error) {
@@ -176,20 +112,59 @@ func getUserInput(reader *bufio.Reader) (string, error) {
 	return strings.TrimSpace(input), nil
 }
 
-func setupClient(serverURL, ablyKey string) (*Client, error) {
-	client, err := NewClient(serverURL, ablyKey)
+func setupClient(serverURL string, requestTimeout time.Duration) (*quizClient.Client, error) {
+	client, err := quizClient.NewClient(quizClient.Config{
+		ServerURL:      serverURL,
+		RequestTimeout: requestTimeout,
+		OnDroppedEvent: func(err *quizClient.DroppedEventError) {
+			fmt.Printf("Possible tampering attempt, %v\n", err)
+		},
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error creating client: %w", err)
 	}
 	return client, nil
 }
 
-func joinSession(client *Client, playerName, playerId string) (string, error) {
-	sessionId, err := client.ConnectToSession(playerName, playerId)
+func joinSession(client *quizClient.Client, playerName, accountId, accountKey string) (protocol.JoinSessionResponse, error) {
+	session, err := client.JoinSession(context.Background(), protocol.JoinSessionRequest{
+		PlayerName: playerName,
+		AccountId:  accountId,
+		AccountKey: accountKey,
+	})
 	if err != nil {
-		return "", fmt.Errorf("error connecting to session: %w", err)
+		return protocol.JoinSessionResponse{}, fmt.Errorf("error connecting to session: %s", quizClient.FriendlyMessage(err))
 	}
-	return sessionId, nil
+	return session, nil
+}
+
+// spectateSession watches a session until it ends, answers are never read from the player.
+func spectateSession(client *quizClient.Client, sessionId string, lineMode bool) {
+	session, err := client.SpectateSession(context.Background(), sessionId)
+	if err != nil {
+		fmt.Println("Error spectating session:", quizClient.FriendlyMessage(err))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if !lineMode && isInteractiveTerminal() {
+		if err := newTUI(client, session).run(ctx); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+
+	fmt.Printf("Spectating session %s\n", session.SessionId)
+	err = client.Listen(ctx, func(event quizClient.Event) {
+		handleEvent(event, cancel)
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	<-ctx.Done()
+	fmt.Println("Session has ended.")
 }
 
 func monitorSessionEnd(ctx context.Context) {
@@ -201,32 +176,63 @@ func monitorSessionEnd(ctx context.Context) {
 }
 
 func main() {
-	serverURL := "http://localhost:8080" // Change to your server's URL.
-	var ablyPrivateKey string
-	// Associate the flags with variables
-	flag.StringVar(&ablyPrivateKey, "ablyKey", "your-default-ably-key", "Ably private key")
+	var serverURL string
+	var accountId string
+	var accountKey string
+	var playerName string
+	var requestTimeout time.Duration
+	var lineMode bool
+	var spectate string
+	// Associate the flags with variables, each can also be set from the environment or a config file.
+	loader := config.NewLoader("quiz-client", "QUIZ_CLIENT_")
+	flags := loader.FlagSet
+	flags.StringVar(&serverURL, "serverURL", "http://localhost:8080", "URL of the quiz server")
+	flags.StringVar(&accountId, "accountId", "", "ID of your player account, play anonymously if empty")
+	flags.StringVar(&accountKey, "accountKey", "", "Key of your player account")
+	flags.StringVar(&playerName, "name", "", "Player name, asked for when empty and not playing as an account")
+	flags.DurationVar(&requestTimeout, "requestTimeout", quizClient.DefaultRequestTimeout, "Timeout of each request to the server")
+	flags.StringVar(&spectate, "spectate", "", "ID of a session to watch as a spectator instead of playing")
+	flags.BoolVar(&lineMode, "lineMode", false, "Use the plain line based interface even when running in a terminal")
+	loader.Secret("accountKey")
 	// Parse the flags
-	flag.Parse()
+	printConfig, err := loader.Load(os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if printConfig {
+		if err := loader.Print(os.Stdout); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
 
-	playerId := uuid.New().String() // Unique player ID generated here.                                    // Unique player ID generated here.
 	reader := bufio.NewReader(os.Stdin)
 
 	// Set up the client.
-	client, err := setupClient(serverURL, ablyPrivateKey)
+	client, err := setupClient(serverURL, requestTimeout)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
+	defer client.Close()
 
-	// Get the player's name and join the session.
-	fmt.Println("Enter your name:")
-	playerName, err := getUserInput(reader)
-	if err != nil {
-		fmt.Println("Error reading player name:", err)
+	if spectate != "" {
+		spectateSession(client, spectate, lineMode)
 		return
 	}
 
-	sessionId, err := joinSession(client, playerName, playerId)
+	// Get the player's name, unless given or playing as an account, and join the session.
+	if accountId == "" && playerName == "" {
+		fmt.Println("Enter your name:")
+		playerName, err = getUserInput(reader)
+		if err != nil {
+			fmt.Println("Error reading player name:", err)
+			return
+		}
+	}
+
+	session, err := joinSession(client, playerName, accountId, accountKey)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -234,11 +240,26 @@ func main() {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	fmt.Printf("Connected to session, please wait for the session to start %s\n", sessionId)
+	// Use the full-screen UI when attached to a terminal, otherwise fall back to line mode.
+	if !lineMode && isInteractiveTerminal() {
+		if err := newTUI(client, session).run(ctx); err != nil {
+			fmt.Println(err)
+		}
+		cancel()
+		return
+	}
+
+	fmt.Printf("Connected to session, please wait for the session to start %s\n", session.SessionId)
 	fmt.Println("During the game, enter answers in the following format: 1, 2, 3, 4, 5... or type 'exit' to leave.")
 
 	go monitorSessionEnd(ctx)
-	go client.ListenToAblyChannel(ctx, sessionId, cancel)
+	err = client.Listen(ctx, func(event quizClient.Event) {
+		handleEvent(event, cancel)
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	// Main loop for player input.
 	for {
@@ -252,12 +273,18 @@ func main() {
 			break
 		}
 
-		err = client.SubmitAnswer(sessionId, playerId, answer)
+		answerIndex, err := parseAnswer(answer)
 		if err != nil {
 			fmt.Println("Error submitting answer:", err)
 			continue
 		}
 
+		err = client.SubmitAnswer(ctx, answerIndex)
+		if err != nil {
+			fmt.Println("Error submitting answer:", quizClient.FriendlyMessage(err))
+			continue
+		}
+
 		fmt.Printf("Submitted answer %s\n", answer)
 	}
 }
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	"strings"
+	"sync"
+	"the-quiz-game/pkg/events"
+	"the-quiz-game/pkg/protocol"
+	quizClient "the-quiz-game/pkg/quiz-client"
+	"time"
+)
+
+// ANSI escape sequences used to draw the full-screen UI.
+const (
+	enterAltScreen = "\x1b[?1049h"
+	leaveAltScreen = "\x1b[?1049l"
+	hideCursor     = "\x1b[?25l"
+	showCursor     = "\x1b[?25h"
+	clearScreen    = "\x1b[H\x1b[2J"
+	bold           = "\x1b[1m"
+	reverse        = "\x1b[7m"
+	reset          = "\x1b[0m"
+)
+
+// isInteractiveTerminal reports whether both stdin and stdout are terminals, which the
+// full-screen UI needs to read single key presses and redraw the screen.
+func isInteractiveTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// tui is the full-screen terminal UI. It shows the current question with selectable options,
+// a countdown to the question deadline, the player's score and the standings after every
+// question, with rank changes, until the final scoreboard. Spectators see
+// the same screen with live answer counts, but cannot select or submit answers.
+type tui struct {
+	client  *quizClient.Client
+	session protocol.JoinSessionResponse
+	redraw  chan struct{}
+
+	mutex      sync.Mutex
+	status     string
+	question   *events.QuestionPayload
+	answered   *events.AnswerCountPayload
+	selected   int
+	submitted  int
+	standings  *events.StandingsPayload
+	scoreBoard *events.ScoreboardPayload
+	ended      bool
+}
+
+func newTUI(client *quizClient.Client, session protocol.JoinSessionResponse) *tui {
+	return &tui{
+		client:    client,
+		session:   session,
+		redraw:    make(chan struct{}, 1),
+		status:    "Waiting for players to join...",
+		submitted: -1,
+	}
+}
+
+// run takes over the terminal until the player quits, or leaves after the quiz has ended.
+func (t *tui) run(ctx context.Context) error {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("error switching terminal to raw mode: %w", err)
+	}
+	defer term.Restore(fd, oldState)
+	fmt.Print(enterAltScreen + hideCursor)
+	defer fmt.Print(showCursor + leaveAltScreen)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	err = t.client.Listen(ctx, t.handleEvent)
+	if err != nil {
+		return err
+	}
+	go t.readKeys(ctx, cancel)
+
+	// Redraw on every change, and regularly so the countdown keeps moving.
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		t.render()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-t.redraw:
+		}
+	}
+}
+
+func (t *tui) requestRedraw() {
+	select {
+	case t.redraw <- struct{}{}:
+	default:
+	}
+}
+
+func (t *tui) setStatus(status string) {
+	t.mutex.Lock()
+	t.status = status
+	t.mutex.Unlock()
+	t.requestRedraw()
+}
+
+func (t *tui) handleEvent(event quizClient.Event) {
+	t.mutex.Lock()
+	switch payload := event.Payload.(type) {
+	case *events.QuizStartingPayload:
+		t.status = payload.Message
+
+	case *events.QuestionPayload:
+		t.question = payload
+		t.answered = nil
+		t.selected = 0
+		t.submitted = -1
+		t.status = "Choose your answer."
+		if t.session.Spectator {
+			t.status = "Players are answering."
+		}
+
+	case *events.ResumedPayload:
+		t.status = payload.Message
+
+	case *events.AnswerCountPayload:
+		// Counts can arrive after the next question, only keep those of the current one.
+		if t.question != nil && payload.QuestionID == t.question.QuestionID {
+			t.answered = payload
+		}
+
+	case *events.StandingsPayload:
+		t.standings = payload
+
+	case *events.ScoreboardPayload:
+		t.scoreBoard = payload
+
+	case *events.QuizEndPayload:
+		t.question = nil
+		t.ended = true
+		t.status = "Quiz has ended, " + payload.Message + ". Press any key to leave."
+	}
+	t.mutex.Unlock()
+	t.requestRedraw()
+}
+
+// readKeys handles key presses: arrow keys (or j/k) move the selection, enter submits it,
+// digits submit an answer directly and q or ctrl+c quits. Spectators can only quit.
+func (t *tui) readKeys(ctx context.Context, cancel context.CancelFunc) {
+	buffer := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buffer)
+		if err != nil || ctx.Err() != nil {
+			cancel()
+			return
+		}
+		key := buffer[:n]
+
+		t.mutex.Lock()
+		ended := t.ended
+		options := 0
+		if t.question != nil {
+			options = len(t.question.PossibleAnswers)
+		}
+		t.mutex.Unlock()
+
+		switch {
+		case ended || string(key) == "q" || key[0] == 3:
+			cancel()
+			return
+		case t.session.Spectator:
+			// Spectators cannot select or submit answers.
+		case string(key) == "\x1b[A" || string(key) == "k":
+			t.moveSelection(-1, options)
+		case string(key) == "\x1b[B" || string(key) == "j":
+			t.moveSelection(1, options)
+		case key[0] == '\r' || key[0] == '\n':
+			t.mutex.Lock()
+			selected := t.selected
+			t.mutex.Unlock()
+			t.submit(ctx, selected, options)
+		case key[0] >= '1' && key[0] <= '9':
+			t.submit(ctx, int(key[0]-'1'), options)
+		}
+	}
+}
+
+func (t *tui) moveSelection(delta, options int) {
+	if options == 0 {
+		return
+	}
+	t.mutex.Lock()
+	t.selected = (t.selected + delta + options) % options
+	t.mutex.Unlock()
+	t.requestRedraw()
+}
+
+func (t *tui) submit(ctx context.Context, answer, options int) {
+	if answer >= options {
+		return
+	}
+	t.mutex.Lock()
+	t.selected = answer
+	t.mutex.Unlock()
+	t.setStatus(fmt.Sprintf("Submitting answer %d...", answer+1))
+
+	go func() {
+		if err := t.client.SubmitAnswer(ctx, answer); err != nil {
+			t.setStatus("Error submitting answer: " + quizClient.FriendlyMessage(err))
+			return
+		}
+		t.mutex.Lock()
+		t.submitted = answer
+		t.mutex.Unlock()
+		t.setStatus(fmt.Sprintf("Submitted answer %d.", answer+1))
+	}()
+}
+
+// render redraws the whole screen. The terminal is in raw mode, so lines end with \r\n.
+func (t *tui) render() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+
+	var screen strings.Builder
+	screen.WriteString(clearScreen)
+	line := func(format string, args ...interface{}) {
+		screen.WriteString(fmt.Sprintf(format, args...) + "\r\n")
+	}
+
+	if t.session.Spectator {
+		line("%sThe Quiz Game%s   Spectating session %s", bold, reset, t.session.SessionId)
+	} else {
+		score := "-"
+		if t.standings != nil {
+			for _, standing := range t.standings.Standings {
+				if standing.PlayerID == t.session.PlayerId {
+					score = fmt.Sprintf("%d (rank %d)", standing.Score, standing.Rank)
+				}
+			}
+		}
+		if t.scoreBoard != nil {
+			for _, entry := range t.scoreBoard.Rankings {
+				if entry.PlayerID == t.session.PlayerId {
+					score = fmt.Sprintf("%d (rank %d)", entry.Score, entry.Rank)
+				}
+			}
+		}
+		line("%sThe Quiz Game%s   Player: %s   Score: %s", bold, reset, t.session.PlayerName, score)
+	}
+	line("%s", strings.Repeat("-", width))
+
+	if t.question != nil {
+		line("%s%s%s", bold, t.question.Question, reset)
+		line("")
+		for i, answer := range t.question.PossibleAnswers {
+			marker := "  "
+			if i == t.submitted {
+				marker = "* "
+			}
+			option := fmt.Sprintf("%s%d. %s", marker, i+1, answer)
+			if i == t.selected && !t.session.Spectator {
+				option = reverse + option + reset
+			}
+			line("  %s", option)
+		}
+		line("")
+		line("Time left: %s", countdown(t.question.Deadline, width/2))
+		if t.answered != nil {
+			line("Answered: %d/%d", t.answered.Answered, t.answered.Players)
+		}
+	}
+
+	line("")
+	line("%s", t.status)
+
+	switch {
+	case t.scoreBoard != nil:
+		line("")
+		line("%sFinal scores%s", bold, reset)
+		for _, entry := range t.scoreBoard.Rankings {
+			line("  %d. %-20s %4d  %d correct  %s average", entry.Rank, entry.Name, entry.Score, entry.CorrectAnswers, averageResponseTime(entry))
+		}
+	case t.standings != nil && t.standings.Hidden:
+		line("")
+		line("%sStandings%s hidden until the end of the quiz", bold, reset)
+	case t.standings != nil:
+		line("")
+		line("%sStandings%s", bold, reset)
+		for _, standing := range t.standings.Standings {
+			line("  %d. %-20s %4d  +%d  %s%s", standing.Rank, standing.Name, standing.Score, standing.Delta, rankChange(standing), streak(standing))
+		}
+	}
+
+	line("")
+	if t.session.Spectator {
+		line("q to quit.")
+	} else {
+		line("Up/down to select, enter to submit, 1-9 to answer directly, q to quit.")
+	}
+	fmt.Print(screen.String())
+}
+
+// countdown renders the time left until the deadline as seconds and a bar of the given width.
+func countdown(deadline time.Time, width int) string {
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return "time is up"
+	}
+	// Questions are short, so scale the bar to ten seconds.
+	filled := int(float64(width) * remaining.Seconds() / 10)
+	if filled > width {
+		filled = width
+	}
+	return fmt.Sprintf("%4.1fs [%s%s]", remaining.Seconds(), strings.Repeat("#", filled), strings.Repeat(" ", width-filled))
+}
@@ -2,11 +2,20 @@ package main
 
 import (
 	"context"
-	"flag"
+	"errors"
 	"fmt"
+	"google.golang.org/grpc"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"the-quiz-game/pkg/config"
 	quizServer "the-quiz-game/pkg/quiz-server"
+	"the-quiz-game/pkg/signing"
+	"time"
 )
 
 func main() {
@@ -14,23 +23,240 @@ func main() {
 	var maxSessionCount int
 	var maxPlayersPerSession int
 	var ablyPrivateKey string
+	var resultsDir string
+	var sharedResultsDir string
+	var accountsFile string
+	var accountsDir string
+	var tokenSecret string
+	var playerTokenTTL time.Duration
+	var ablyTokenTTL time.Duration
+	var signingKeyFile string
+	var listenAddr string
+	var grpcListenAddr string
+	var grpcServiceKey string
+	var readTimeout time.Duration
+	var writeTimeout time.Duration
+	var hideStandingsQuestions int
+	var shutdownTimeout time.Duration
+	var snapshotDir string
+	var snapshotInterval time.Duration
+	var registryDir string
+	var nodeId string
+	var advertiseURL string
+	var answerQueueSize int
+	var commandTimeout time.Duration
+	var rateLimits quizServer.RateLimits
+	var waitingRoomTimeout time.Duration
+	var maxSessionLifetime time.Duration
 
-	// Associate the flags with variables
-	flag.IntVar(&maxSessionCount, "maxSessionCount", 1, "Maximum number of sessions")
-	flag.IntVar(&maxPlayersPerSession, "maxPlayers", 1, "Maximum players per session")
-	flag.StringVar(&ablyPrivateKey, "ablyKey", "your-default-ably-key", "Ably private key")
+	// Associate the flags with variables, each can also be set from the environment or a config file.
+	loader := config.NewLoader("quiz-server", "QUIZ_SERVER_")
+	flags := loader.FlagSet
+	flags.StringVar(&listenAddr, "listenAddr", ":8080", "Address the HTTP server listens on")
+	flags.StringVar(&grpcListenAddr, "grpcListenAddr", "", "Address the gRPC API listens on, it is not served if empty")
+	flags.StringVar(&grpcServiceKey, "grpcServiceKey", "", "Key internal services must send to call the gRPC API, required with grpcListenAddr")
+	flags.DurationVar(&readTimeout, "readTimeout", 10*time.Second, "Maximum duration for reading a request")
+	flags.DurationVar(&writeTimeout, "writeTimeout", 10*time.Second, "Maximum duration for writing a response")
+	flags.DurationVar(&commandTimeout, "commandTimeout", quizServer.DefaultCommandTimeout, "How long a request waits for the session manager or its session before giving up")
+	flags.IntVar(&maxSessionCount, "maxSessionCount", 1, "Maximum number of sessions")
+	flags.IntVar(&maxPlayersPerSession, "maxPlayers", 1, "Maximum players per session")
+	flags.DurationVar(&waitingRoomTimeout, "waitingRoomTimeout", 5*time.Minute, "How long a waiting room stays open without a player joining, 0 keeps them open")
+	flags.DurationVar(&maxSessionLifetime, "maxSessionLifetime", time.Hour, "How long a session may run before it is ended, 0 disables the limit")
+	flags.DurationVar(&shutdownTimeout, "shutdownTimeout", time.Minute, "How long sessions in progress may finish on shutdown before they are stopped")
+	flags.IntVar(&answerQueueSize, "answerQueueSize", 1024, "Answers each session queues before refusing more with 503")
+	flags.Float64Var(&rateLimits.ClientRate, "clientRate", quizServer.DefaultRateLimits.ClientRate, "Joins, spectates and answers allowed per second from each client IP, 0 disables the limit")
+	flags.IntVar(&rateLimits.ClientBurst, "clientBurst", quizServer.DefaultRateLimits.ClientBurst, "Requests a client IP can make at once before clientRate applies")
+	flags.Float64Var(&rateLimits.AnswerRate, "answerRate", quizServer.DefaultRateLimits.AnswerRate, "Answers allowed per second from each player, 0 disables the limit")
+	flags.IntVar(&rateLimits.AnswerBurst, "answerBurst", quizServer.DefaultRateLimits.AnswerBurst, "Answers a player can send at once before answerRate applies")
+	flags.IntVar(&rateLimits.MaxSessionsPerClient, "maxSessionsPerClient", quizServer.DefaultRateLimits.MaxSessionsPerClient, "Running sessions a single client IP may have created, 0 disables the limit")
+	flags.Int64Var(&rateLimits.MaxBodyBytes, "maxBodyBytes", quizServer.DefaultRateLimits.MaxBodyBytes, "Maximum size of request bodies and gRPC messages")
+	flags.BoolVar(&rateLimits.TrustForwardedFor, "trustForwardedFor", false, "Identify clients by the X-Forwarded-For address added by the proxy in front of the server")
+	flags.IntVar(&hideStandingsQuestions, "hideStandingsQuestions", 0, "Number of final questions after which the standings are hidden until the quiz ends")
+	flags.StringVar(&ablyPrivateKey, "ablyKey", "your-default-ably-key", "Ably private key")
+	flags.StringVar(&resultsDir, "resultsDir", "results", "Directory where completed session results are stored")
+	flags.StringVar(&sharedResultsDir, "sharedResultsDir", "", "Directory shared by every node of a cluster where completed session results are stored, replacing resultsDir")
+	flags.StringVar(&snapshotDir, "snapshotDir", "snapshots", "Directory where snapshots of running sessions are stored, to restore them after a restart")
+	flags.DurationVar(&snapshotInterval, "snapshotInterval", time.Second, "How often running sessions are snapshotted, 0 disables snapshots")
+	flags.StringVar(&registryDir, "registryDir", "", "Directory shared by every node of a cluster to record which node owns each session, the server runs on its own if empty")
+	flags.StringVar(&nodeId, "nodeId", "", "ID of this node in the cluster, the host name if empty")
+	flags.StringVar(&advertiseURL, "advertiseURL", "", "URL the other nodes of the cluster reach this node at, e.g. http://10.0.0.1:8080")
+	flags.StringVar(&accountsFile, "accountsFile", "accounts/accounts.json", "File where player accounts are stored")
+	flags.StringVar(&accountsDir, "accountsDir", "", "Directory shared by every node of a cluster where player accounts are stored, replacing accountsFile")
+	flags.StringVar(&tokenSecret, "tokenSecret", "", "Secret used to sign player tokens, if empty one is generated and kept in snapshotDir. Required in a cluster")
+	flags.DurationVar(&playerTokenTTL, "playerTokenTTL", time.Hour, "How long player tokens are valid for")
+	flags.StringVar(&signingKeyFile, "signingKeyFile", "keys/event-signing.pem", "Private key used to sign session events, generated if missing")
+	flags.DurationVar(&ablyTokenTTL, "ablyTokenTTL", 10*time.Minute, "How long the realtime tokens given to players are valid for")
+
+	loader.Secret("ablyKey", "tokenSecret", "grpcServiceKey")
 
 	// Parse the flags
-	flag.Parse()
+	printConfig, err := loader.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if printConfig {
+		if err := loader.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var snapshotStore quizServer.SnapshotStore
+	if snapshotInterval > 0 {
+		if snapshotStore, err = quizServer.NewFileSnapshotStore(snapshotDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if grpcListenAddr != "" && grpcServiceKey == "" {
+		log.Fatal("grpcServiceKey is required to serve the gRPC API")
+	}
 
-	ctx := context.Background()
-	newQuiz, err := quizServer.NewQuizServer(ctx, maxSessionCount, maxPlayersPerSession, ablyPrivateKey)
+	var registry quizServer.SessionRegistry
+	if registryDir != "" {
+		if advertiseURL == "" {
+			log.Fatal("advertiseURL is required when running in a cluster")
+		}
+		// Nodes accept the tokens, forwarded requests and accounts of each other, and share results.
+		if tokenSecret == "" {
+			log.Fatal("tokenSecret is required when running in a cluster")
+		}
+		if accountsDir == "" {
+			log.Fatal("accountsDir is required when running in a cluster")
+		}
+		if sharedResultsDir == "" {
+			log.Fatal("sharedResultsDir is required when running in a cluster")
+		}
+		if nodeId == "" {
+			if nodeId, err = os.Hostname(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if registry, err = quizServer.NewFileRegistry(registryDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var resultsStore quizServer.ResultsStore
+	if sharedResultsDir != "" {
+		resultsStore, err = quizServer.NewDirResultsStore(sharedResultsDir)
+	} else {
+		resultsStore, err = quizServer.NewFileResultsStore(resultsDir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var accountStore quizServer.AccountStore
+	if accountsDir != "" {
+		accountStore, err = quizServer.NewDirAccountStore(accountsDir)
+	} else {
+		accountStore, err = quizServer.NewFileAccountStore(accountsFile)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	secret := []byte(tokenSecret)
+	if tokenSecret == "" && snapshotStore != nil {
+		// Restored sessions need the tokens of their players, so the generated secret is kept
+		// with the snapshots.
+		if secret, err = quizServer.LoadOrCreateTokenSecret(filepath.Join(snapshotDir, "token-secret")); err != nil {
+			log.Fatal(err)
+		}
+	} else if tokenSecret == "" {
+		// Tokens signed with a random secret stop working when the server restarts.
+		if secret, err = quizServer.NewRandomTokenSecret(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	signingKey, err := signing.LoadOrCreatePrivateKey(signingKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The context is cancelled on SIGINT or SIGTERM to shut down gracefully.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	newQuiz, err := quizServer.NewQuizServer(ctx, quizServer.QuizServerConfig{
+		MaxSessionCount:        maxSessionCount,
+		MaxPlayersPerSession:   maxPlayersPerSession,
+		AblyPrivateKey:         ablyPrivateKey,
+		ResultsStore:           resultsStore,
+		AccountStore:           accountStore,
+		TokenIssuer:            quizServer.NewTokenIssuer(secret, playerTokenTTL),
+		AblyTokenTTL:           ablyTokenTTL,
+		EventSigner:            signing.NewSigner(signingKey),
+		HideStandingsQuestions: hideStandingsQuestions,
+		SnapshotStore:          snapshotStore,
+		SnapshotInterval:       snapshotInterval,
+		AnswerQueueSize:        answerQueueSize,
+		CommandTimeout:         commandTimeout,
+		Registry:               registry,
+		Node:                   quizServer.Node{ID: nodeId, URL: advertiseURL},
+		RateLimits:             rateLimits,
+		WaitingRoomTimeout:     waitingRoomTimeout,
+		MaxSessionLifetime:     maxSessionLifetime,
+		GRPCServiceKey:         grpcServiceKey,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Printf("starting listener\n")
-	http.Handle("/connect-to-session", http.HandlerFunc(newQuiz.ConnectToSessionHandler))
-	http.Handle("/submit-answer", http.HandlerFunc(newQuiz.SubmitAnswerHandler))
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	server := &http.Server{
+		Addr:         listenAddr,
+		Handler:      newQuiz.Handler(),
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	var grpcServer *grpc.Server
+	if grpcListenAddr != "" {
+		listener, err := net.Listen("tcp", grpcListenAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcServer = newQuiz.GRPCServer()
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
 
+	<-ctx.Done()
+	// Restore the default signal handling, so a second signal kills the server right away.
+	stop()
+	fmt.Printf("Shutting down, waiting up to %s for sessions in progress to finish\n", shutdownTimeout)
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelDrain()
+	if err := newQuiz.Shutdown(drainCtx); err != nil {
+		fmt.Printf("Error stopping sessions: %v\n", err)
+	}
+
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancelHTTP()
+	if err := server.Shutdown(httpCtx); err != nil {
+		fmt.Printf("Error shutting down HTTP server: %v\n", err)
+	}
+	if grpcServer != nil {
+		// Event streams end with their sessions, calls still running are cut once httpCtx is done.
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-httpCtx.Done():
+			grpcServer.Stop()
+		}
+	}
+	newQuiz.Close()
+	fmt.Println("Server stopped.")
 }
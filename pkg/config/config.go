@@ -0,0 +1,184 @@
+// Package config loads the configuration of the quiz binaries from flags, environment variables
+// and an optional JSON config file. Every setting is a flag; the same setting can be given as an
+// environment variable named after the flag (maxPlayers with prefix QUIZ_SERVER_ is
+// QUIZ_SERVER_MAX_PLAYERS) or as a key of the config file named exactly like the flag.
+//
+// Precedence, highest first: flags, environment variables, config file, defaults.
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	configFlag      = "config"
+	printConfigFlag = "print-config"
+)
+
+// Loader wraps a flag.FlagSet. Settings are registered on FlagSet as usual, then Load applies
+// every source in order of precedence.
+type Loader struct {
+	FlagSet   *flag.FlagSet
+	envPrefix string
+	secrets   map[string]bool
+	sources   map[string]string
+
+	configPath  string
+	printConfig bool
+}
+
+// NewLoader creates a Loader for a binary, envPrefix is prepended to every environment variable.
+func NewLoader(name, envPrefix string) *Loader {
+	l := &Loader{
+		FlagSet:   flag.NewFlagSet(name, flag.ExitOnError),
+		envPrefix: envPrefix,
+		secrets:   make(map[string]bool),
+		sources:   make(map[string]string),
+	}
+	l.FlagSet.StringVar(&l.configPath, configFlag, "", "Optional JSON config file, also read from "+l.EnvName(configFlag))
+	l.FlagSet.BoolVar(&l.printConfig, printConfigFlag, false, "Print the effective configuration and exit")
+	return l
+}
+
+// Secret marks settings whose values are masked when the configuration is printed.
+func (l *Loader) Secret(names ...string) {
+	for _, name := range names {
+		l.secrets[name] = true
+	}
+}
+
+// EnvName returns the environment variable a setting is read from.
+func (l *Loader) EnvName(name string) string {
+	var builder strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		// Start a new word at every upper case letter following a lower case letter or digit,
+		// and at the last capital of an acronym followed by a lower case letter.
+		if i > 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextIsLower) {
+				builder.WriteRune('_')
+			}
+		}
+		if r == '-' {
+			r = '_'
+		}
+		builder.WriteRune(unicode.ToUpper(r))
+	}
+	return l.envPrefix + builder.String()
+}
+
+// Load parses args and applies every source. It reports whether --print-config was given.
+func (l *Loader) Load(args []string) (bool, error) {
+	if err := l.FlagSet.Parse(args); err != nil {
+		return false, err
+	}
+
+	// Remember what was given on the command line, then start again from the defaults so
+	// the lower precedence sources can be applied first.
+	commandLine := make(map[string]string)
+	l.FlagSet.Visit(func(f *flag.Flag) {
+		commandLine[f.Name] = f.Value.String()
+	})
+	var resetErr error
+	l.FlagSet.VisitAll(func(f *flag.Flag) {
+		if err := f.Value.Set(f.DefValue); err != nil && resetErr == nil {
+			resetErr = err
+		}
+		l.sources[f.Name] = "default"
+	})
+	if resetErr != nil {
+		return false, resetErr
+	}
+
+	configPath := commandLine[configFlag]
+	if configPath == "" {
+		configPath = os.Getenv(l.EnvName(configFlag))
+	}
+	if configPath != "" {
+		if err := l.applyFile(configPath); err != nil {
+			return false, err
+		}
+	}
+
+	var envErr error
+	l.FlagSet.VisitAll(func(f *flag.Flag) {
+		envName := l.EnvName(f.Name)
+		value, ok := os.LookupEnv(envName)
+		if !ok || envErr != nil {
+			return
+		}
+		envErr = l.set(f.Name, value, "env "+envName)
+	})
+	if envErr != nil {
+		return false, envErr
+	}
+
+	for name, value := range commandLine {
+		if err := l.set(name, value, "flag"); err != nil {
+			return false, err
+		}
+	}
+	return l.printConfig, nil
+}
+
+func (l *Loader) set(name, value, source string) error {
+	if err := l.FlagSet.Set(name, value); err != nil {
+		return fmt.Errorf("invalid value %q for %s from %s: %w", value, name, source, err)
+	}
+	l.sources[name] = source
+	return nil
+}
+
+// applyFile applies a JSON object whose keys are setting names. Values may be strings, numbers
+// or booleans, durations are given as strings such as "10m".
+func (l *Loader) applyFile(path string) error {
+	fileContent, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(fileContent, &settings); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	for name, raw := range settings {
+		if name == configFlag || name == printConfigFlag || l.FlagSet.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting %q in config file %s", name, path)
+		}
+		value := string(raw)
+		var text string
+		if json.Unmarshal(raw, &text) == nil {
+			value = text
+		}
+		if err := l.set(name, value, "file "+path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Print writes every setting with its effective value and where the value came from.
+func (l *Loader) Print(w io.Writer) error {
+	lines := make([]string, 0)
+	l.FlagSet.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFlag || f.Name == printConfigFlag {
+			return
+		}
+		value := f.Value.String()
+		if l.secrets[f.Name] && value != "" {
+			value = "********"
+		}
+		lines = append(lines, fmt.Sprintf("%s=%s (%s)", f.Name, value, l.sources[f.Name]))
+	})
+	sort.Strings(lines)
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Flags beat environment variables, which beat the config file, which beats the defaults.
+func TestLoader_Precedence(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{
+		"listenAddr": ":9000",
+		"maxPlayers": 4,
+		"ablyKey": "file-key",
+		"playerTokenTTL": "5m"
+	}`), 0o644))
+	t.Setenv("TEST_CONFIG", configPath)
+	t.Setenv("TEST_MAX_PLAYERS", "6")
+	t.Setenv("TEST_ABLY_KEY", "env-key")
+
+	var listenAddr, ablyKey, resultsDir string
+	var maxPlayers int
+	var playerTokenTTL time.Duration
+	loader := NewLoader("test", "TEST_")
+	loader.FlagSet.StringVar(&listenAddr, "listenAddr", ":8080", "")
+	loader.FlagSet.StringVar(&ablyKey, "ablyKey", "", "")
+	loader.FlagSet.StringVar(&resultsDir, "resultsDir", "results", "")
+	loader.FlagSet.IntVar(&maxPlayers, "maxPlayers", 1, "")
+	loader.FlagSet.DurationVar(&playerTokenTTL, "playerTokenTTL", time.Hour, "")
+	loader.Secret("ablyKey")
+
+	printConfig, err := loader.Load([]string{"--ablyKey=flag-key", "--print-config"})
+	require.NoError(t, err)
+	require.True(t, printConfig)
+
+	require.Equal(t, ":9000", listenAddr)
+	require.Equal(t, 6, maxPlayers)
+	require.Equal(t, "flag-key", ablyKey)
+	require.Equal(t, "results", resultsDir)
+	require.Equal(t, 5*time.Minute, playerTokenTTL)
+
+	var printed bytes.Buffer
+	require.NoError(t, loader.Print(&printed))
+	require.Equal(t, "ablyKey=******** (flag)\n"+
+		"listenAddr=:9000 (file "+configPath+")\n"+
+		"maxPlayers=6 (env TEST_MAX_PLAYERS)\n"+
+		"playerTokenTTL=5m0s (file "+configPath+")\n"+
+		"resultsDir=results (default)\n", printed.String())
+}
+
+func TestLoader_EnvName(t *testing.T) {
+	loader := NewLoader("test", "QUIZ_SERVER_")
+	require.Equal(t, "QUIZ_SERVER_MAX_SESSION_COUNT", loader.EnvName("maxSessionCount"))
+	require.Equal(t, "QUIZ_SERVER_PLAYER_TOKEN_TTL", loader.EnvName("playerTokenTTL"))
+	require.Equal(t, "QUIZ_SERVER_SERVER_URL", loader.EnvName("serverURL"))
+	require.Equal(t, "QUIZ_SERVER_PRINT_CONFIG", loader.EnvName("print-config"))
+}
@@ -0,0 +1,57 @@
+// Package events defines the versioned envelope every realtime event published by the quiz
+// server is wrapped in, along with the typed payload of each event. It is shared by the server
+// and the client, and the JSON Schema in schema.json describes it for third-party clients.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Version is the current envelope schema version. It is bumped whenever a change is made that
+// existing clients could not read.
+const Version = 2
+
+// Envelope wraps the payload of every event.
+type Envelope struct {
+	Type      Type            `json:"type"`
+	Version   int             `json:"version"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Sequence  uint64          `json:"sequence"`
+	Timestamp time.Time       `json:"timestamp"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// NewEnvelope marshals payload into an envelope of the current version.
+func NewEnvelope(eventType Type, sessionId string, sequence uint64, payload interface{}) (Envelope, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		Type:      eventType,
+		Version:   Version,
+		SessionID: sessionId,
+		Sequence:  sequence,
+		Timestamp: time.Now().UTC(),
+		Payload:   jsonData,
+	}, nil
+}
+
+// DecodePayload unmarshals the payload into the type registered for the envelope's event type,
+// returning a pointer to it, e.g. *QuestionPayload for a new_question event.
+func (e Envelope) DecodePayload() (interface{}, error) {
+	if e.Version != Version {
+		return nil, fmt.Errorf("unsupported event version %d", e.Version)
+	}
+	newPayload, ok := payloadTypes[e.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %q", e.Type)
+	}
+	payload := newPayload()
+	if err := json.Unmarshal(e.Payload, payload); err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", e.Type, err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"the-quiz-game/pkg/signing"
+)
+
+func sealEvent(t *testing.T, signer *signing.Signer, eventType Type, sessionId string, sequence uint64, payload interface{}) string {
+	envelope, err := NewEnvelope(eventType, sessionId, sequence, payload)
+	require.NoError(t, err)
+	sealed, err := Seal(signer, envelope)
+	require.NoError(t, err)
+	return sealed
+}
+
+// Events must only open when signed by the server, for the right session, in order.
+func TestVerifier_Open(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer := signing.NewSigner(privateKey)
+
+	verifier, err := NewVerifier(signer.PublicKey(), "session1")
+	require.NoError(t, err)
+
+	question := &QuestionPayload{Question: "What is the capital of France?", PossibleAnswers: []string{"Paris", "London"}}
+	first := sealEvent(t, signer, NewQuestion, "session1", 1, question)
+	envelope, err := verifier.Open(string(NewQuestion), first)
+	require.NoError(t, err)
+	payload, err := envelope.DecodePayload()
+	require.NoError(t, err)
+	require.Equal(t, question, payload)
+
+	// Replaying the same event is rejected.
+	_, err = verifier.Open(string(NewQuestion), first)
+	require.ErrorIs(t, err, ErrOutOfOrder)
+
+	// Events published under another name are rejected.
+	second := sealEvent(t, signer, QuizStarting, "session1", 2, QuizStartingPayload{})
+	_, err = verifier.Open(string(QuizEnd), second)
+	require.ErrorIs(t, err, ErrWrongType)
+
+	// Events altered in transit are rejected.
+	var signed SignedEnvelope
+	require.NoError(t, json.Unmarshal([]byte(second), &signed))
+	signed.Envelope = json.RawMessage(`{"type":"quiz-starting","version":1,"sessionId":"session1","sequence":2}`)
+	tampered, err := json.Marshal(signed)
+	require.NoError(t, err)
+	_, err = verifier.Open(string(QuizStarting), string(tampered))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Events signed by anyone else are rejected.
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	forged := sealEvent(t, signing.NewSigner(otherKey), QuizEnd, "session1", 3, QuizEndPayload{})
+	_, err = verifier.Open(string(QuizEnd), forged)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Events of another session are rejected.
+	foreign := sealEvent(t, signer, QuizEnd, "session2", 4, QuizEndPayload{})
+	_, err = verifier.Open(string(QuizEnd), foreign)
+	require.ErrorIs(t, err, ErrWrongSession)
+
+	// Gaps in the sequence are allowed.
+	_, err = verifier.Open(string(QuizEnd), sealEvent(t, signer, QuizEnd, "session1", 5, QuizEndPayload{}))
+	require.NoError(t, err)
+}
+
+// The exported schema must list every event type the server can publish.
+func TestSchema_ListsEveryEventType(t *testing.T) {
+	var schema struct {
+		Defs struct {
+			Envelope struct {
+				Properties struct {
+					Type struct {
+						Enum []Type `json:"enum"`
+					} `json:"type"`
+				} `json:"properties"`
+			} `json:"envelope"`
+		} `json:"$defs"`
+	}
+	require.NoError(t, json.Unmarshal(Schema, &schema))
+
+	types := make([]Type, 0, len(payloadTypes))
+	for eventType := range payloadTypes {
+		types = append(types, eventType)
+	}
+	require.ElementsMatch(t, types, schema.Defs.Envelope.Properties.Type.Enum)
+}
@@ -0,0 +1,108 @@
+package events
+
+import "time"
+
+// Type identifies an event, it is also used as the realtime message name.
+type Type string
+
+const (
+	QuizStarting       Type = "quiz-starting"
+	NewQuestion        Type = "new_question"
+	Scoreboard         Type = "scoreboard"
+	QuizEnd            Type = "quiz-end"
+	LeaderboardChanged Type = "leaderboard-changed"
+	AnswerCount        Type = "answer-count"
+	Standings          Type = "standings"
+	Resumed            Type = "resumed"
+)
+
+// payloadTypes creates an empty payload for each event type.
+var payloadTypes = map[Type]func() interface{}{
+	QuizStarting:       func() interface{} { return &QuizStartingPayload{} },
+	NewQuestion:        func() interface{} { return &QuestionPayload{} },
+	Scoreboard:         func() interface{} { return &ScoreboardPayload{} },
+	QuizEnd:            func() interface{} { return &QuizEndPayload{} },
+	LeaderboardChanged: func() interface{} { return &LeaderboardChangedPayload{} },
+	AnswerCount:        func() interface{} { return &AnswerCountPayload{} },
+	Standings:          func() interface{} { return &StandingsPayload{} },
+	Resumed:            func() interface{} { return &ResumedPayload{} },
+}
+
+// QuizStartingPayload announces that a session is full and the quiz is about to start.
+type QuizStartingPayload struct {
+	StartsInSeconds int    `json:"startsInSeconds"`
+	Message         string `json:"message"`
+}
+
+// QuestionPayload carries the question and its possible answers, never the correct answer.
+// Answers must reference the question ID and are accepted until the deadline.
+type QuestionPayload struct {
+	QuestionID      string    `json:"questionId"`
+	QuestionIndex   int       `json:"questionIndex"`
+	Question        string    `json:"question"`
+	PossibleAnswers []string  `json:"possibleAnswers"`
+	Deadline        time.Time `json:"deadline"`
+}
+
+// ScoreboardPayload carries the final ranking of every player, best first.
+type ScoreboardPayload struct {
+	Rankings []ScoreboardEntry `json:"rankings"`
+}
+
+// ScoreboardEntry is a player's final place. Players with the same score share a rank, and the
+// average response time covers every answer the player gave.
+type ScoreboardEntry struct {
+	Rank                  int    `json:"rank"`
+	PlayerID              string `json:"playerId"`
+	Name                  string `json:"name"`
+	Score                 int    `json:"score"`
+	CorrectAnswers        int    `json:"correctAnswers"`
+	AverageResponseTimeMs int64  `json:"averageResponseTimeMs"`
+}
+
+// QuizEndPayload announces the session has ended.
+type QuizEndPayload struct {
+	Message string `json:"message"`
+}
+
+// LeaderboardChangedPayload announces a completed session changed the leaderboards.
+type LeaderboardChangedPayload struct {
+	SessionID string   `json:"sessionId"`
+	Periods   []string `json:"periods"`
+}
+
+// AnswerCountPayload reports how many players answered the current question so far, without
+// revealing their answers.
+type AnswerCountPayload struct {
+	QuestionID string `json:"questionId"`
+	Answered   int    `json:"answered"`
+	Players    int    `json:"players"`
+}
+
+// StandingsPayload ranks the players after a question closed. Standings are hidden, and empty,
+// for the final questions of sessions configured to keep the suspense until the scoreboard.
+type StandingsPayload struct {
+	QuestionID    string     `json:"questionId"`
+	QuestionIndex int        `json:"questionIndex"`
+	Hidden        bool       `json:"hidden"`
+	Standings     []Standing `json:"standings"`
+}
+
+// Standing is a player's place after a question. Players with the same score share a rank.
+// PreviousRank is 0 when there were no previous standings, Delta is the score gained by the
+// question and Streak the number of questions in a row answered correctly.
+type Standing struct {
+	Rank         int    `json:"rank"`
+	PreviousRank int    `json:"previousRank"`
+	PlayerID     string `json:"playerId"`
+	Name         string `json:"name"`
+	Score        int    `json:"score"`
+	Delta        int    `json:"delta"`
+	Streak       int    `json:"streak"`
+}
+
+// ResumedPayload announces a session was restored after a server restart and its game goes on.
+// An open question is published again with the time it had left.
+type ResumedPayload struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,8 @@
+package events
+
+import _ "embed"
+
+// Schema is the JSON Schema of the signed envelope published on the wire.
+//
+//go:embed schema.json
+var Schema []byte
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"the-quiz-game/pkg/signing"
+)
+
+var (
+	ErrInvalidSignature = errors.New("event signature is invalid")
+	ErrWrongSession     = errors.New("event was published for a different session")
+	ErrWrongType        = errors.New("event type does not match the message name")
+	ErrOutOfOrder       = errors.New("event sequence number is out of order")
+)
+
+// SignedEnvelope is what is published on the wire: the envelope exactly as it was signed,
+// and the server's signature over it.
+type SignedEnvelope struct {
+	Envelope  json.RawMessage `json:"envelope"`
+	Signature string          `json:"signature"`
+}
+
+// Seal marshals and signs an envelope, returning the JSON to publish.
+func Seal(signer *signing.Signer, envelope Envelope) (string, error) {
+	envelopeJSON, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := json.Marshal(SignedEnvelope{
+		Envelope:  envelopeJSON,
+		Signature: signer.Sign(envelopeJSON),
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(sealed), nil
+}
+
+// Verifier opens the signed envelopes of a single session, rejecting forged, foreign and
+// replayed events. It is not safe for concurrent use.
+type Verifier struct {
+	publicKey    signing.PublicKey
+	sessionId    string
+	lastSequence uint64
+}
+
+// NewVerifier creates a Verifier from the base64 encoded public key handed out by the server.
+func NewVerifier(publicKey, sessionId string) (*Verifier, error) {
+	key, err := signing.ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{publicKey: key, sessionId: sessionId}, nil
+}
+
+// Open verifies a sealed envelope received under the message name and returns it.
+// Sequence numbers start at 1 and must always increase, gaps are allowed as realtime
+// delivery can drop messages.
+func (v *Verifier) Open(name, sealed string) (Envelope, error) {
+	var signed SignedEnvelope
+	if err := json.Unmarshal([]byte(sealed), &signed); err != nil {
+		return Envelope{}, fmt.Errorf("message is not a signed event: %w", err)
+	}
+	if !v.publicKey.Verify(signed.Envelope, signed.Signature) {
+		return Envelope{}, ErrInvalidSignature
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(signed.Envelope, &envelope); err != nil {
+		return Envelope{}, fmt.Errorf("invalid event envelope: %w", err)
+	}
+	if string(envelope.Type) != name {
+		return Envelope{}, ErrWrongType
+	}
+	if envelope.SessionID != v.sessionId {
+		return Envelope{}, ErrWrongSession
+	}
+	if envelope.Sequence <= v.lastSequence {
+		return Envelope{}, ErrOutOfOrder
+	}
+	v.lastSequence = envelope.Sequence
+	return envelope, nil
+}
@@ -0,0 +1,144 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ably/ably-go/ably"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// APIError is returned when the server answers a request with a non-OK status. Code is set
+// when the server sent an ErrorResponse.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s failed with status %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// APIClient is a thin client for the quiz server's HTTP API.
+type APIClient struct {
+	ServerURL  string
+	HTTPClient *http.Client
+}
+
+// NewAPIClient creates an APIClient, using http.DefaultClient if httpClient is nil.
+func NewAPIClient(serverURL string, httpClient *http.Client) *APIClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &APIClient{
+		ServerURL:  strings.TrimSuffix(serverURL, "/"),
+		HTTPClient: httpClient,
+	}
+}
+
+// do sends request as JSON, with the player token if one is given, and decodes the JSON
+// response into response unless it is nil.
+func (c *APIClient) do(ctx context.Context, method, path, token string, request, response interface{}) error {
+	var body io.Reader
+	if request != nil {
+		jsonData, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.ServerURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Handle non-OK responses.
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("error reading response body: %w", err)
+		}
+		apiErr := &APIError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(bodyBytes)),
+		}
+		var errorResponse ErrorResponse
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") && json.Unmarshal(bodyBytes, &errorResponse) == nil {
+			apiErr.Code = errorResponse.Code
+			apiErr.Message = errorResponse.Message
+		}
+		return apiErr
+	}
+
+	if response == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// JoinSession joins a session, see JoinSessionRequest.
+func (c *APIClient) JoinSession(ctx context.Context, request JoinSessionRequest) (JoinSessionResponse, error) {
+	var response JoinSessionResponse
+	err := c.do(ctx, http.MethodPost, SessionPath(AnySession, SessionPlayers), "", request, &response)
+	return response, err
+}
+
+// SpectateSession joins a session as a spectator, see SpectateSessionRequest.
+func (c *APIClient) SpectateSession(ctx context.Context, request SpectateSessionRequest) (JoinSessionResponse, error) {
+	var response JoinSessionResponse
+	err := c.do(ctx, http.MethodPost, SessionPath(request.SessionId, SessionSpectators), "", nil, &response)
+	return response, err
+}
+
+// SubmitAnswer submits an answer as the player the token was issued to.
+func (c *APIClient) SubmitAnswer(ctx context.Context, token string, request SubmitAnswerRequest) (SubmitAnswerResponse, error) {
+	var response SubmitAnswerResponse
+	err := c.do(ctx, http.MethodPost, SessionPath(request.SessionId, SessionAnswers), token, request, &response)
+	return response, err
+}
+
+// RequestAblyToken fetches a realtime token request scoped to the player's session channel.
+func (c *APIClient) RequestAblyToken(ctx context.Context, token string) (ably.TokenRequest, error) {
+	var response ably.TokenRequest
+	err := c.do(ctx, http.MethodPost, TokenV1Path, token, nil, &response)
+	return response, err
+}
+
+// CreateAccount creates a persistent player account.
+func (c *APIClient) CreateAccount(ctx context.Context, request CreateAccountRequest) (CreateAccountResponse, error) {
+	var response CreateAccountResponse
+	err := c.do(ctx, http.MethodPost, AccountsV1Path, "", request, &response)
+	return response, err
+}
+
+// GetAccount fetches the public profile of an account.
+func (c *APIClient) GetAccount(ctx context.Context, accountId string) (AccountResponse, error) {
+	var response AccountResponse
+	err := c.do(ctx, http.MethodGet, AccountsV1Path+"/"+url.PathEscape(accountId), "", nil, &response)
+	return response, err
+}
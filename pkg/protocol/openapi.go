@@ -0,0 +1,9 @@
+package protocol
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI document of the versioned HTTP API, served at OpenAPIPath. Its request
+// schemas are checked against the request types by the tests of this package.
+//
+//go:embed openapi.json
+var OpenAPI []byte
@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// jsonFields returns the JSON names of the fields of a struct type, and those always sent.
+func jsonFields(t reflect.Type) (fields, required []string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			embedded, embeddedRequired := jsonFields(field.Type)
+			fields = append(fields, embedded...)
+			required = append(required, embeddedRequired...)
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		fields = append(fields, name)
+		if options != "omitempty" {
+			required = append(required, name)
+		}
+	}
+	return fields, required
+}
+
+type openAPISchema struct {
+	Required   []string                   `json:"required"`
+	Properties map[string]json.RawMessage `json:"properties"`
+}
+
+func (s openAPISchema) properties() []string {
+	properties := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		properties = append(properties, name)
+	}
+	return properties
+}
+
+// The schemas of the OpenAPI document must describe the fields of the protocol types, so
+// requests the server validates are those the document allows.
+func TestOpenAPI_MatchesTypes(t *testing.T) {
+	var document struct {
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(OpenAPI, &document))
+
+	schema := func(name string) openAPISchema {
+		var schema openAPISchema
+		require.NoError(t, json.Unmarshal(document.Components.Schemas[name], &schema), name)
+		return schema
+	}
+
+	// Requests only need the same properties, which of them are required is checked by Validate.
+	for name, v := range map[string]interface{}{
+		"JoinSessionRequest":   JoinSessionRequest{},
+		"SubmitAnswerRequest":  SubmitAnswerRequest{},
+		"CreateAccountRequest": CreateAccountRequest{},
+	} {
+		fields, _ := jsonFields(reflect.TypeOf(v))
+		require.ElementsMatch(t, fields, schema(name).properties(), name)
+	}
+
+	// Responses must also require every field that is always sent.
+	for name, v := range map[string]interface{}{
+		"JoinSessionResponse":  JoinSessionResponse{},
+		"SubmitAnswerResponse": SubmitAnswerResponse{},
+		"AccountResponse":      AccountResponse{},
+		"ErrorResponse":        ErrorResponse{},
+	} {
+		fields, required := jsonFields(reflect.TypeOf(v))
+		require.ElementsMatch(t, fields, schema(name).properties(), name)
+		require.ElementsMatch(t, required, schema(name).Required, name)
+	}
+}
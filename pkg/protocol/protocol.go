@@ -0,0 +1,179 @@
+// Package protocol holds the request and response types of the quiz server's HTTP API, shared
+// by the server and its clients. The realtime events are defined in the events package.
+package protocol
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+// APIPrefix is the prefix of every path of the versioned HTTP API, described by OpenAPI.
+const APIPrefix = "/api/v1"
+
+// Paths of the versioned HTTP API, the paths of a session are built with SessionPath.
+const (
+	TokenV1Path       = APIPrefix + "/token"
+	AccountsV1Path    = APIPrefix + "/accounts"
+	LeaderboardV1Path = APIPrefix + "/leaderboard"
+	EventSchemaV1Path = APIPrefix + "/schema/events.json"
+	OpenAPIPath       = APIPrefix + "/openapi.json"
+)
+
+// AnySession is the session ID to join the first session waiting for players, or a new one.
+const AnySession = "any"
+
+// Resources of a session, see SessionPath.
+const (
+	SessionPlayers    = "players"
+	SessionSpectators = "spectators"
+	SessionAnswers    = "answers"
+	SessionResult     = "result"
+)
+
+// SessionPath returns the path of a resource of a session, e.g. SessionPath(AnySession, SessionPlayers).
+func SessionPath(sessionId, resource string) string {
+	return APIPrefix + "/sessions/" + url.PathEscape(sessionId) + "/" + resource
+}
+
+// Paths of the unversioned HTTP API, still served for older clients.
+const (
+	ConnectToSessionPath = "/connect-to-session"
+	SubmitAnswerPath     = "/submit-answer"
+	TokenPath            = "/token"
+	AccountsPath         = "/accounts"
+	EventSchemaPath      = "/schema/events.json"
+	SpectatePath         = "/spectate"
+)
+
+// JoinSessionRequest asks to join a session, either anonymously with a player name or as
+// an account with its ID and key.
+type JoinSessionRequest struct {
+	PlayerName string `json:"playerName"`
+	AccountId  string `json:"accountId,omitempty"`
+	AccountKey string `json:"accountKey,omitempty"`
+}
+
+func (r JoinSessionRequest) Validate() error {
+	if r.AccountId == "" && r.PlayerName == "" {
+		return errors.New("playerName is required when not joining as an account")
+	}
+	if r.AccountId != "" && r.AccountKey == "" {
+		return errors.New("accountKey is required when joining as an account")
+	}
+	return nil
+}
+
+// JoinSessionResponse identifies the session joined and the player the server issued.
+// The token must be sent as a bearer token on player endpoints, and the event public key
+// verifies the events published on the session channel. Spectators get the same response
+// with Spectator set, their token only allows watching the session.
+type JoinSessionResponse struct {
+	SessionId      string    `json:"sessionId"`
+	PlayerId       string    `json:"playerId"`
+	PlayerName     string    `json:"playerName"`
+	Token          string    `json:"token"`
+	TokenExpiresAt time.Time `json:"tokenExpiresAt"`
+	EventPublicKey string    `json:"eventPublicKey"`
+	Spectator      bool      `json:"spectator,omitempty"`
+}
+
+// SpectateSessionRequest asks to watch a session without taking a player slot.
+type SpectateSessionRequest struct {
+	SessionId string `json:"sessionId"`
+}
+
+// SubmitAnswerRequest submits a zero-based answer index for a question, identified by the
+// question ID of its new_question event. Requests without a question ID answer the question
+// at QuestionIndex. The session ID is part of the path of the versioned API, it is only
+// required on the unversioned SubmitAnswerPath.
+type SubmitAnswerRequest struct {
+	SessionId     string `json:"sessionId,omitempty"`
+	QuestionId    string `json:"questionId,omitempty"`
+	QuestionIndex int    `json:"questionIndex"`
+	Answer        int    `json:"answer"`
+}
+
+func (r SubmitAnswerRequest) Validate() error {
+	if r.QuestionIndex < 0 {
+		return errors.New("questionIndex must be 0 or higher")
+	}
+	return nil
+}
+
+// Error codes returned in ErrorResponse by every endpoint. They are stable, clients should
+// rely on them rather than on messages.
+const (
+	// 400 Bad Request.
+	ErrorCodeInvalidRequest = "invalid_request"
+	ErrorCodeInvalidAnswer  = "invalid_answer"
+	// 401 Unauthorized.
+	ErrorCodeUnauthorized = "unauthorized"
+	// 403 Forbidden.
+	ErrorCodeForbidden = "forbidden"
+	// 404 Not Found.
+	ErrorCodeNotFound        = "not_found"
+	ErrorCodeSessionNotFound = "session_not_found"
+	ErrorCodePlayerNotFound  = "player_not_found"
+	ErrorCodeAccountNotFound = "account_not_found"
+	// 405 Method Not Allowed.
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	// 413 Request Entity Too Large.
+	ErrorCodeRequestTooLarge = "request_too_large"
+	// 421 Misdirected Request, only returned by the gRPC API, the HTTP API forwards requests for
+	// sessions of another node to it.
+	ErrorCodeWrongNode = "wrong_node"
+	// 409 Conflict.
+	ErrorCodeAlreadyAnswered  = "already_answered"
+	ErrorCodeWrongQuestion    = "wrong_question"
+	ErrorCodeNoActiveQuestion = "no_active_question"
+	ErrorCodeLateAnswer       = "late_answer"
+	ErrorCodeSessionFull      = "session_full"
+	// 429 Too Many Requests.
+	ErrorCodeTooManySessions = "too_many_sessions"
+	ErrorCodeRateLimited     = "rate_limited"
+	// 503 Service Unavailable.
+	ErrorCodeShuttingDown = "shutting_down"
+	ErrorCodeBusy         = "busy"
+	// 504 Gateway Timeout.
+	ErrorCodeTimeout = "timeout"
+	// 500 Internal Server Error.
+	ErrorCodeInternal = "internal_error"
+)
+
+// ErrorResponse is the body of a rejected request that carries a machine-readable error code.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type SubmitAnswerResponse struct {
+	Message string `json:"message"`
+}
+
+type CreateAccountRequest struct {
+	Name string `json:"name"`
+}
+
+func (r CreateAccountRequest) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+// AccountResponse is the public profile of an account.
+type AccountResponse struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Rating      int       `json:"rating"`
+	GamesPlayed int       `json:"gamesPlayed"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// CreateAccountResponse is the new account and the key needed to join sessions as it.
+// The key is never returned again.
+type CreateAccountResponse struct {
+	AccountResponse
+	AccountKey string `json:"accountKey"`
+}
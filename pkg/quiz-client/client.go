@@ -0,0 +1,296 @@
+// Package quiz_client is a Go SDK for the quiz server. It joins sessions, submits answers and
+// delivers the verified realtime events of the session, for players, bots, dashboards and tests.
+package quiz_client
+
+import (
+	"context"
+	"fmt"
+	"github.com/ably/ably-go/ably"
+	"net/http"
+	"sync"
+	"the-quiz-game/pkg/events"
+	"the-quiz-game/pkg/protocol"
+	"time"
+)
+
+// DefaultRequestTimeout is used for HTTP calls when Config.RequestTimeout is zero.
+const DefaultRequestTimeout = 10 * time.Second
+
+// Config configures a Client.
+type Config struct {
+	// ServerURL is the base URL of the quiz server, e.g. http://localhost:8080.
+	ServerURL string
+	// HTTPClient is used for every HTTP call, http.DefaultClient if nil. Set its Transport to
+	// customise how the server is reached.
+	HTTPClient *http.Client
+	// RequestTimeout bounds each HTTP call, on top of any deadline of the caller's context.
+	RequestTimeout time.Duration
+	// AblyOptions are added to the options of the realtime client, e.g. to change its environment.
+	AblyOptions []ably.ClientOption
+	// OnDroppedEvent is called with every realtime message that failed verification.
+	OnDroppedEvent func(err *DroppedEventError)
+}
+
+// Event is a verified realtime event. Payload holds a pointer to the typed payload of the
+// event type, e.g. *events.QuestionPayload for events.NewQuestion.
+type Event struct {
+	Type     events.Type
+	Envelope events.Envelope
+	Payload  interface{}
+}
+
+// Client is a single player's connection to the quiz server. A Client joins one session.
+type Client struct {
+	config Config
+	api    *protocol.APIClient
+
+	mutex         sync.Mutex
+	session       protocol.JoinSessionResponse
+	joined        bool
+	ablyClient    *ably.Realtime
+	eventVerifier *events.Verifier
+	// The question answers are submitted against, tracked from the session's events.
+	question     events.QuestionPayload
+	questionOpen bool
+}
+
+func NewClient(config Config) (*Client, error) {
+	if config.ServerURL == "" {
+		return nil, fmt.Errorf("server URL is required")
+	}
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = DefaultRequestTimeout
+	}
+	return &Client{
+		config: config,
+		api:    protocol.NewAPIClient(config.ServerURL, config.HTTPClient),
+	}, nil
+}
+
+// API returns the underlying HTTP API client, for calls that do not need a session.
+func (c *Client) API() *protocol.APIClient {
+	return c.api
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, c.config.RequestTimeout)
+}
+
+// Session returns the session joined, and whether the client has joined one.
+func (c *Client) Session() (protocol.JoinSessionResponse, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.session, c.joined
+}
+
+// JoinSession joins a session, anonymously with a player name or as an account, and connects
+// to the realtime service with tokens scoped to that session.
+func (c *Client) JoinSession(ctx context.Context, request protocol.JoinSessionRequest) (protocol.JoinSessionResponse, error) {
+	return c.join(ctx, func(ctx context.Context) (protocol.JoinSessionResponse, error) {
+		return c.api.JoinSession(ctx, request)
+	})
+}
+
+// SpectateSession joins a session as a spectator, which receives the session's events without
+// taking a player slot and cannot submit answers.
+func (c *Client) SpectateSession(ctx context.Context, sessionId string) (protocol.JoinSessionResponse, error) {
+	return c.join(ctx, func(ctx context.Context) (protocol.JoinSessionResponse, error) {
+		return c.api.SpectateSession(ctx, protocol.SpectateSessionRequest{SessionId: sessionId})
+	})
+}
+
+// join calls the server with request and connects to the realtime service for the session joined.
+func (c *Client) join(ctx context.Context, request func(ctx context.Context) (protocol.JoinSessionResponse, error)) (protocol.JoinSessionResponse, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.joined {
+		return protocol.JoinSessionResponse{}, ErrAlreadyJoined
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	response, err := request(ctx)
+	if err != nil {
+		return protocol.JoinSessionResponse{}, err
+	}
+	verifier, err := events.NewVerifier(response.EventPublicKey, response.SessionId)
+	if err != nil {
+		return protocol.JoinSessionResponse{}, err
+	}
+
+	options := append([]ably.ClientOption{ably.WithAuthCallback(c.requestAblyToken)}, c.config.AblyOptions...)
+	ablyClient, err := ably.NewRealtime(options...)
+	if err != nil {
+		return protocol.JoinSessionResponse{}, fmt.Errorf("failed to create Ably realtime client: %w", err)
+	}
+
+	c.session = response
+	c.joined = true
+	c.eventVerifier = verifier
+	c.ablyClient = ablyClient
+	return response, nil
+}
+
+// requestAblyToken is the Ably auth callback. It asks the server for a token request that only
+// allows subscribing to the player's session channel.
+func (c *Client) requestAblyToken(ctx context.Context, _ ably.TokenParams) (ably.Tokener, error) {
+	session, joined := c.Session()
+	if !joined {
+		return nil, ErrNotJoined
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	tokenRequest, err := c.api.RequestAblyToken(ctx, session.Token)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting realtime token: %w", err)
+	}
+	return tokenRequest, nil
+}
+
+// CurrentQuestion returns the question answers are submitted against, and whether it is still
+// open. It is only tracked while the client listens to the session's events.
+func (c *Client) CurrentQuestion() (events.QuestionPayload, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.question, c.questionOpen && time.Now().Before(c.question.Deadline)
+}
+
+// trackEvent keeps the current question up to date.
+func (c *Client) trackEvent(event Event) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch payload := event.Payload.(type) {
+	case *events.QuestionPayload:
+		c.question = *payload
+		c.questionOpen = true
+	case *events.QuizEndPayload:
+		c.questionOpen = false
+	}
+}
+
+// SubmitAnswer submits the zero-based index of the chosen answer to the current question.
+// Answers are checked against the question locally, so the client must be listening to the
+// session's events.
+func (c *Client) SubmitAnswer(ctx context.Context, answer int) error {
+	session, joined := c.Session()
+	if !joined {
+		return ErrNotJoined
+	}
+	if session.Spectator {
+		return ErrSpectator
+	}
+	c.mutex.Lock()
+	question, open := c.question, c.questionOpen
+	c.mutex.Unlock()
+	if !open {
+		return ErrNoActiveQuestion
+	}
+	if !time.Now().Before(question.Deadline) {
+		return ErrLateAnswer
+	}
+	if answer < 0 || answer >= len(question.PossibleAnswers) {
+		return ErrInvalidAnswer
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	_, err := c.api.SubmitAnswer(ctx, session.Token, protocol.SubmitAnswerRequest{
+		SessionId:     session.SessionId,
+		QuestionId:    question.QuestionID,
+		QuestionIndex: question.QuestionIndex,
+		Answer:        answer,
+	})
+	return err
+}
+
+// Listen subscribes to the session's events and calls handler with every verified event until
+// ctx is done. Messages that fail verification are passed to Config.OnDroppedEvent instead.
+func (c *Client) Listen(ctx context.Context, handler func(Event)) error {
+	session, joined := c.Session()
+	if !joined {
+		return ErrNotJoined
+	}
+
+	channel := c.ablyClient.Channels.Get(session.SessionId)
+	unsubscribe, err := channel.SubscribeAll(ctx, func(msg *ably.Message) {
+		event, err := c.openEvent(msg)
+		if err != nil {
+			if c.config.OnDroppedEvent != nil {
+				c.config.OnDroppedEvent(&DroppedEventError{Name: msg.Name, Err: err})
+			}
+			return
+		}
+		c.trackEvent(event)
+		handler(event)
+	})
+	if err != nil {
+		return fmt.Errorf("error subscribing to channel: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+	}()
+	return nil
+}
+
+// Events is Listen with a channel instead of a callback. The channel is closed once ctx is done.
+func (c *Client) Events(ctx context.Context) (<-chan Event, error) {
+	eventChan := make(chan Event, 16)
+	// The mutex stops an event being sent while, or after, the channel is closed.
+	var mutex sync.Mutex
+	closed := false
+	err := c.Listen(ctx, func(event Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case eventChan <- event:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		mutex.Lock()
+		defer mutex.Unlock()
+		closed = true
+		close(eventChan)
+	}()
+	return eventChan, nil
+}
+
+// openEvent verifies a realtime message and decodes its payload. Messages arrive one at a
+// time per channel, the mutex only guards against listening more than once.
+func (c *Client) openEvent(msg *ably.Message) (Event, error) {
+	sealed, ok := msg.Data.(string)
+	if !ok {
+		return Event{}, fmt.Errorf("expected string data in message")
+	}
+
+	c.mutex.Lock()
+	envelope, err := c.eventVerifier.Open(msg.Name, sealed)
+	c.mutex.Unlock()
+	if err != nil {
+		return Event{}, err
+	}
+
+	payload, err := envelope.DecodePayload()
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: envelope.Type, Envelope: envelope, Payload: payload}, nil
+}
+
+// Close closes the realtime connection.
+func (c *Client) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.ablyClient != nil {
+		c.ablyClient.Close()
+	}
+}
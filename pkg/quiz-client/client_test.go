@@ -0,0 +1,109 @@
+package quiz_client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"github.com/ably/ably-go/ably"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"the-quiz-game/pkg/events"
+	"the-quiz-game/pkg/protocol"
+	"the-quiz-game/pkg/signing"
+	"time"
+)
+
+// The client must keep the identity issued at join, send its token with answers and surface
+// rejected requests as APIErrors.
+func TestClient_JoinAndSubmitAnswer(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	var submitted protocol.SubmitAnswerRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc(protocol.SessionPath(protocol.AnySession, protocol.SessionPlayers), func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(protocol.JoinSessionResponse{
+			SessionId:      "session1",
+			PlayerId:       "player1",
+			Token:          "token1",
+			EventPublicKey: signing.NewSigner(privateKey).PublicKey(),
+		}))
+	})
+	mux.HandleFunc(protocol.SessionPath("session1", protocol.SessionAnswers), func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token1" {
+			http.Error(w, "player token is invalid", http.StatusUnauthorized)
+			return
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&submitted))
+		if submitted.Answer == 2 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			require.NoError(t, json.NewEncoder(w).Encode(protocol.ErrorResponse{
+				Code:    protocol.ErrorCodeLateAnswer,
+				Message: "answer arrived after the question closed",
+			}))
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(protocol.SubmitAnswerResponse{Message: "ok"}))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewClient(Config{
+		ServerURL:   server.URL,
+		HTTPClient:  server.Client(),
+		AblyOptions: []ably.ClientOption{ably.WithAutoConnect(false)},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+	require.ErrorIs(t, client.SubmitAnswer(ctx, 0), ErrNotJoined)
+
+	session, err := client.JoinSession(ctx, protocol.JoinSessionRequest{PlayerName: "Alice"})
+	require.NoError(t, err)
+	require.Equal(t, "session1", session.SessionId)
+
+	_, err = client.JoinSession(ctx, protocol.JoinSessionRequest{PlayerName: "Alice"})
+	require.ErrorIs(t, err, ErrAlreadyJoined)
+
+	// Answers are only sent for an open question, within its possible answers.
+	require.ErrorIs(t, client.SubmitAnswer(ctx, 0), ErrNoActiveQuestion)
+	client.trackEvent(Event{Type: events.NewQuestion, Payload: &events.QuestionPayload{
+		QuestionID:      "question3",
+		QuestionIndex:   2,
+		PossibleAnswers: []string{"a", "b", "c"},
+		Deadline:        time.Now().Add(time.Minute),
+	}})
+
+	require.NoError(t, client.SubmitAnswer(ctx, 1))
+	require.Equal(t, protocol.SubmitAnswerRequest{SessionId: "session1", QuestionId: "question3", QuestionIndex: 2, Answer: 1}, submitted)
+
+	require.ErrorIs(t, client.SubmitAnswer(ctx, -1), ErrInvalidAnswer)
+	require.ErrorIs(t, client.SubmitAnswer(ctx, 3), ErrInvalidAnswer)
+
+	err = client.SubmitAnswer(ctx, 2)
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	require.Equal(t, protocol.ErrorCodeLateAnswer, apiErr.Code)
+	require.Equal(t, "answer arrived after the question closed", apiErr.Message)
+	require.Equal(t, "Too late, the question has closed.", FriendlyMessage(err))
+
+	// Past the deadline the answer is late without asking the server.
+	client.trackEvent(Event{Type: events.NewQuestion, Payload: &events.QuestionPayload{
+		QuestionID:      "question4",
+		PossibleAnswers: []string{"a", "b"},
+		Deadline:        time.Now().Add(-time.Second),
+	}})
+	err = client.SubmitAnswer(ctx, 1)
+	require.ErrorIs(t, err, ErrLateAnswer)
+	require.Equal(t, ErrLateAnswer.Error(), FriendlyMessage(err))
+
+	client.trackEvent(Event{Type: events.QuizEnd, Payload: &events.QuizEndPayload{}})
+	require.ErrorIs(t, client.SubmitAnswer(ctx, 1), ErrNoActiveQuestion)
+}
@@ -0,0 +1,77 @@
+package quiz_client
+
+import (
+	"errors"
+	"the-quiz-game/pkg/protocol"
+)
+
+var (
+	// ErrNotJoined is returned by calls that need a session before JoinSession succeeded.
+	ErrNotJoined = errors.New("client has not joined a session")
+	// ErrAlreadyJoined is returned when joining a second session with the same client.
+	ErrAlreadyJoined = errors.New("client has already joined a session")
+	// ErrInvalidAnswer is returned for answers outside the possible answers of the current question.
+	ErrInvalidAnswer = errors.New("answer is not one of the possible answers")
+	// ErrNoActiveQuestion is returned when answering before a question arrived or after the end of the quiz.
+	ErrNoActiveQuestion = errors.New("no question is open for answers")
+	// ErrSpectator is returned when a client that joined as a spectator submits an answer.
+	ErrSpectator = errors.New("spectators cannot submit answers")
+	// ErrLateAnswer is returned when answering after the deadline of the current question. The
+	// server rejects answers it receives too late with protocol.ErrorCodeLateAnswer.
+	ErrLateAnswer = errors.New("answer is too late, the question has closed")
+)
+
+// APIError is returned when the server rejects a request, see protocol.APIError.
+type APIError = protocol.APIError
+
+// friendlyMessages explain to players why the server rejected a request, by error code.
+var friendlyMessages = map[string]string{
+	protocol.ErrorCodeInvalidRequest:   "The request was not valid, please update the client.",
+	protocol.ErrorCodeInvalidAnswer:    "That is not one of the possible answers.",
+	protocol.ErrorCodeUnauthorized:     "Your session has expired or your account details are wrong, please join again.",
+	protocol.ErrorCodeForbidden:        "You are not allowed to do that in this session.",
+	protocol.ErrorCodeSessionNotFound:  "The session does not exist or has already ended.",
+	protocol.ErrorCodePlayerNotFound:   "You are not a player of this session.",
+	protocol.ErrorCodeAccountNotFound:  "There is no account with that ID.",
+	protocol.ErrorCodeAlreadyAnswered:  "You already answered this question.",
+	protocol.ErrorCodeWrongQuestion:    "That answer is for another question.",
+	protocol.ErrorCodeNoActiveQuestion: "There is no question to answer right now.",
+	protocol.ErrorCodeLateAnswer:       "Too late, the question has closed.",
+	protocol.ErrorCodeSessionFull:      "The session filled up before you could join, please try again.",
+	protocol.ErrorCodeTooManySessions:  "All games are full right now, please try again in a moment.",
+	protocol.ErrorCodeRateLimited:      "Slow down, you are sending too many requests.",
+	protocol.ErrorCodeRequestTooLarge:  "The request was too large, please update the client.",
+	protocol.ErrorCodeShuttingDown:     "The server is shutting down, please try again later.",
+	protocol.ErrorCodeBusy:             "The server is busy, please try again.",
+	protocol.ErrorCodeTimeout:          "The server took too long to respond, please try again.",
+	protocol.ErrorCodeNotFound:         "The server does not know this request, please update the client.",
+	protocol.ErrorCodeMethodNotAllowed: "The server does not support this request, please update the client.",
+	protocol.ErrorCodeInternal:         "Something went wrong on the server, please try again.",
+}
+
+// FriendlyMessage describes an error for players. Rejections by the server are explained by
+// their error code, other errors are described as they are.
+func FriendlyMessage(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if message, ok := friendlyMessages[apiErr.Code]; ok {
+			return message
+		}
+	}
+	return err.Error()
+}
+
+// DroppedEventError describes a realtime message that was dropped because it could not be
+// verified as coming from the server, which usually means someone tried to tamper with the game.
+type DroppedEventError struct {
+	Name string
+	Err  error
+}
+
+func (e *DroppedEventError) Error() string {
+	return "dropped " + e.Name + " event: " + e.Err.Error()
+}
+
+func (e *DroppedEventError) Unwrap() error {
+	return e.Err
+}
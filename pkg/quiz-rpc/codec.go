@@ -0,0 +1,33 @@
+// Package quiz_rpc defines the gRPC API of the quiz server, for internal services. Its messages
+// are the JSON types of this package and of the protocol package, exchanged with the "json"
+// codec, so no generated code is needed on either side. Clients select the codec with
+// grpc.CallContentSubtype(CodecName), NewClient does it for them. quiz.proto documents the wire
+// contract, for clients in other languages.
+package quiz_rpc
+
+import (
+	"encoding/json"
+	"google.golang.org/grpc/encoding"
+)
+
+// CodecName is the content subtype of the gRPC API, requests are sent as application/grpc+json.
+const CodecName = "json"
+
+func init() {
+	encoding.RegisterCodec(Codec{})
+}
+
+// Codec marshals gRPC messages as JSON.
+type Codec struct{}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (Codec) Name() string {
+	return CodecName
+}
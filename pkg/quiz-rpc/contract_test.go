@@ -0,0 +1,276 @@
+package quiz_rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"the-quiz-game/pkg/protocol"
+	"time"
+)
+
+// goMessages are the Go types of the messages of quiz.proto.
+var goMessages = map[string]func() interface{}{
+	"JoinSessionRequest":     func() interface{} { return new(JoinSessionRequest) },
+	"JoinSessionResponse":    func() interface{} { return new(protocol.JoinSessionResponse) },
+	"SpectateSessionRequest": func() interface{} { return new(protocol.SpectateSessionRequest) },
+	"SubmitAnswerRequest":    func() interface{} { return new(protocol.SubmitAnswerRequest) },
+	"SubmitAnswerResponse":   func() interface{} { return new(protocol.SubmitAnswerResponse) },
+	"LeaveSessionRequest":    func() interface{} { return new(LeaveSessionRequest) },
+	"LeaveSessionResponse":   func() interface{} { return new(LeaveSessionResponse) },
+	"GetSessionRequest":      func() interface{} { return new(GetSessionRequest) },
+	"ListSessionsRequest":    func() interface{} { return new(ListSessionsRequest) },
+	"ListSessionsResponse":   func() interface{} { return new(ListSessionsResponse) },
+	"SessionInfo":            func() interface{} { return new(SessionInfo) },
+	"SessionPlayer":          func() interface{} { return new(SessionPlayer) },
+	"WatchEventsRequest":     func() interface{} { return new(WatchEventsRequest) },
+	"Event":                  func() interface{} { return new(Event) },
+}
+
+// The service and messages of quiz.proto must match ServiceDesc and the Go types exchanged by
+// the JSON codec, field by field, so clients generated from it interoperate with the server.
+func TestQuizProto_MatchesGoTypes(t *testing.T) {
+	file := parseQuizProto(t)
+
+	service := file.Services().ByName("QuizService")
+	require.NotNil(t, service)
+	require.Equal(t, ServiceName, string(service.FullName()))
+	var methods, streams []string
+	for i := 0; i < service.Methods().Len(); i++ {
+		method := service.Methods().Get(i)
+		if method.IsStreamingServer() {
+			streams = append(streams, string(method.Name()))
+		} else {
+			methods = append(methods, string(method.Name()))
+		}
+	}
+	var descMethods, descStreams []string
+	for _, method := range ServiceDesc.Methods {
+		descMethods = append(descMethods, method.MethodName)
+	}
+	for _, stream := range ServiceDesc.Streams {
+		descStreams = append(descStreams, stream.StreamName)
+	}
+	require.ElementsMatch(t, descMethods, methods)
+	require.ElementsMatch(t, descStreams, streams)
+
+	require.Equal(t, len(goMessages), file.Messages().Len())
+	for i := 0; i < file.Messages().Len(); i++ {
+		descriptor := file.Messages().Get(i)
+		newGo, ok := goMessages[string(descriptor.Name())]
+		require.True(t, ok, "no Go type for message %s", descriptor.Name())
+
+		t.Run(string(descriptor.Name()), func(t *testing.T) {
+			// Every field of the Go type must be a field of the message.
+			goValue := newGo()
+			fillGo(reflect.ValueOf(goValue).Elem())
+			jsonData, err := json.Marshal(goValue)
+			require.NoError(t, err)
+			message := dynamicpb.NewMessage(descriptor)
+			require.NoError(t, protojson.Unmarshal(jsonData, message), "%s", jsonData)
+			protoJSON, err := protojson.Marshal(message)
+			require.NoError(t, err)
+			roundTripped := newGo()
+			require.NoError(t, json.Unmarshal(protoJSON, roundTripped))
+			require.Equal(t, goValue, roundTripped)
+
+			// Every field of the message must be a field of the Go type.
+			message = dynamicpb.NewMessage(descriptor)
+			fillProto(message)
+			protoJSON, err = protojson.Marshal(message)
+			require.NoError(t, err)
+			decoder := json.NewDecoder(bytes.NewReader(protoJSON))
+			decoder.DisallowUnknownFields()
+			goValue = newGo()
+			require.NoError(t, decoder.Decode(goValue), "%s", protoJSON)
+			jsonData, err = json.Marshal(goValue)
+			require.NoError(t, err)
+			roundTrippedMessage := dynamicpb.NewMessage(descriptor)
+			require.NoError(t, protojson.Unmarshal(jsonData, roundTrippedMessage))
+			require.True(t, proto.Equal(message, roundTrippedMessage), "%s became %s", protoJSON, jsonData)
+		})
+	}
+}
+
+// fillGo sets every field of a Go value to something other than its zero value.
+func fillGo(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("value")
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		v.SetInt(7)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fillGo(v.Index(0))
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			fillGo(v.Field(i))
+		}
+	}
+}
+
+// fillProto sets every field of a message to something other than its default value.
+func fillProto(message protoreflect.Message) {
+	fields := message.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.IsList() {
+			list := message.Mutable(field).List()
+			if field.Kind() == protoreflect.MessageKind {
+				element := list.NewElement()
+				fillProto(element.Message())
+				list.Append(element)
+			} else {
+				list.Append(scalarValue(field))
+			}
+			continue
+		}
+		if field.Kind() == protoreflect.MessageKind {
+			fillProto(message.Mutable(field).Message())
+			continue
+		}
+		message.Set(field, scalarValue(field))
+	}
+}
+
+func scalarValue(field protoreflect.FieldDescriptor) protoreflect.Value {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString("value")
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(true)
+	case protoreflect.Int32Kind:
+		return protoreflect.ValueOfInt32(7)
+	case protoreflect.Int64Kind:
+		return protoreflect.ValueOfInt64(7)
+	default:
+		panic(fmt.Sprintf("unsupported field kind %s", field.Kind()))
+	}
+}
+
+var (
+	protoComment = regexp.MustCompile(`//[^\n]*`)
+	protoToken   = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_.]*|\d+|"[^"]*"|[{}();=]`)
+)
+
+var protoScalars = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bool":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"int32":  descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+}
+
+// parseQuizProto parses quiz.proto, supporting only what it uses: scalar, message and repeated
+// fields, and unary or server streaming methods.
+func parseQuizProto(t *testing.T) protoreflect.FileDescriptor {
+	source, err := os.ReadFile("quiz.proto")
+	require.NoError(t, err)
+	tokens := protoToken.FindAllString(protoComment.ReplaceAllString(string(source), ""), -1)
+	next := func() string {
+		require.NotEmpty(t, tokens, "unexpected end of quiz.proto")
+		token := tokens[0]
+		tokens = tokens[1:]
+		return token
+	}
+	expect := func(want string) {
+		got := next()
+		require.Equal(t, want, got, "unexpected token in quiz.proto")
+	}
+
+	file := &descriptorpb.FileDescriptorProto{Name: proto.String("quiz.proto")}
+	typeName := func(name string) string {
+		if strings.Contains(name, ".") {
+			return "." + name
+		}
+		return "." + file.GetPackage() + "." + name
+	}
+	for len(tokens) > 0 {
+		switch keyword := next(); keyword {
+		case "syntax":
+			expect("=")
+			file.Syntax = proto.String(strings.Trim(next(), `"`))
+			expect(";")
+		case "package":
+			file.Package = proto.String(next())
+			expect(";")
+		case "import":
+			file.Dependency = append(file.Dependency, strings.Trim(next(), `"`))
+			expect(";")
+		case "option":
+			for next() != ";" {
+			}
+		case "service":
+			service := &descriptorpb.ServiceDescriptorProto{Name: proto.String(next())}
+			expect("{")
+			for token := next(); token != "}"; token = next() {
+				require.Equal(t, "rpc", token)
+				method := &descriptorpb.MethodDescriptorProto{Name: proto.String(next())}
+				expect("(")
+				method.InputType = proto.String(typeName(next()))
+				expect(")")
+				expect("returns")
+				expect("(")
+				output := next()
+				if output == "stream" {
+					method.ServerStreaming = proto.Bool(true)
+					output = next()
+				}
+				method.OutputType = proto.String(typeName(output))
+				expect(")")
+				expect(";")
+				service.Method = append(service.Method, method)
+			}
+			file.Service = append(file.Service, service)
+		case "message":
+			message := &descriptorpb.DescriptorProto{Name: proto.String(next())}
+			expect("{")
+			for token := next(); token != "}"; token = next() {
+				field := &descriptorpb.FieldDescriptorProto{Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()}
+				if token == "repeated" {
+					field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+					token = next()
+				}
+				if scalar, ok := protoScalars[token]; ok {
+					field.Type = scalar.Enum()
+				} else {
+					field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+					field.TypeName = proto.String(typeName(token))
+				}
+				field.Name = proto.String(next())
+				expect("=")
+				number, err := strconv.Atoi(next())
+				require.NoError(t, err)
+				field.Number = proto.Int32(int32(number))
+				expect(";")
+				message.Field = append(message.Field, field)
+			}
+			file.MessageType = append(file.MessageType, message)
+		default:
+			t.Fatalf("unsupported %q in quiz.proto", keyword)
+		}
+	}
+
+	descriptor, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return descriptor
+}
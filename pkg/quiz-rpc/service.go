@@ -0,0 +1,302 @@
+package quiz_rpc
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+	"the-quiz-game/pkg/protocol"
+	"time"
+)
+
+// ServiceName is the full name of the quiz service, its methods are /quiz.v1.QuizService/<Method>.
+const ServiceName = "quiz.v1.QuizService"
+
+// ErrorDomain is the domain of the errdetails.ErrorInfo attached to rejected calls, whose reason
+// is one of the error codes of the protocol package.
+const ErrorDomain = "quiz-server"
+
+// authorizationKey is the metadata key of the player token, sent as "Bearer <token>".
+const authorizationKey = "authorization"
+
+// serviceKeyKey is the metadata key of the service key every call must carry.
+const serviceKeyKey = "x-quiz-service-key"
+
+// JoinSessionRequest joins the session SessionId while it waits for players, or the first
+// waiting session when SessionId is empty or protocol.AnySession.
+type JoinSessionRequest struct {
+	SessionId string `json:"sessionId,omitempty"`
+	protocol.JoinSessionRequest
+}
+
+// LeaveSessionRequest removes the player of the call's token from their session.
+type LeaveSessionRequest struct {
+	SessionId string `json:"sessionId"`
+}
+
+type LeaveSessionResponse struct {
+	Message string `json:"message"`
+}
+
+type GetSessionRequest struct {
+	SessionId string `json:"sessionId"`
+}
+
+type ListSessionsRequest struct{}
+
+type ListSessionsResponse struct {
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// SessionInfo is the state of a running session. CurrentQuestion is the zero-based index of
+// the question being asked, or of the next one between questions.
+type SessionInfo struct {
+	SessionId       string          `json:"sessionId"`
+	State           string          `json:"state"`
+	Players         []SessionPlayer `json:"players"`
+	MaxPlayers      int32           `json:"maxPlayers"`
+	Spectators      int32           `json:"spectators"`
+	CurrentQuestion int32           `json:"currentQuestion"`
+	QuestionCount   int32           `json:"questionCount"`
+}
+
+// SessionPlayer is a player of a session, Left is set once they left a game in progress.
+type SessionPlayer struct {
+	PlayerId string `json:"playerId"`
+	Name     string `json:"name"`
+	Score    int32  `json:"score"`
+	Left     bool   `json:"left,omitempty"`
+}
+
+// WatchEventsRequest streams the events of the session of the call's token.
+type WatchEventsRequest struct {
+	SessionId string `json:"sessionId"`
+}
+
+// Event is an event published on a session channel: its type and the signed envelope, exactly
+// as published on the realtime channel, to be opened with an events.Verifier.
+type Event struct {
+	Name string `json:"name"`
+	Data string `json:"data"`
+}
+
+// QuizServiceServer is implemented by the quiz server.
+type QuizServiceServer interface {
+	JoinSession(ctx context.Context, request *JoinSessionRequest) (*protocol.JoinSessionResponse, error)
+	SpectateSession(ctx context.Context, request *protocol.SpectateSessionRequest) (*protocol.JoinSessionResponse, error)
+	SubmitAnswer(ctx context.Context, request *protocol.SubmitAnswerRequest) (*protocol.SubmitAnswerResponse, error)
+	LeaveSession(ctx context.Context, request *LeaveSessionRequest) (*LeaveSessionResponse, error)
+	GetSession(ctx context.Context, request *GetSessionRequest) (*SessionInfo, error)
+	ListSessions(ctx context.Context, request *ListSessionsRequest) (*ListSessionsResponse, error)
+	WatchEvents(request *WatchEventsRequest, stream EventSender) error
+}
+
+// EventSender sends the events of WatchEvents, until its context is done.
+type EventSender interface {
+	Send(event *Event) error
+	Context() context.Context
+}
+
+type eventSender struct {
+	grpc.ServerStream
+}
+
+func (s eventSender) Send(event *Event) error {
+	return s.ServerStream.SendMsg(event)
+}
+
+// ServiceDesc describes the quiz service, RegisterQuizServiceServer registers it.
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*QuizServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod("JoinSession", QuizServiceServer.JoinSession),
+		unaryMethod("SpectateSession", QuizServiceServer.SpectateSession),
+		unaryMethod("SubmitAnswer", QuizServiceServer.SubmitAnswer),
+		unaryMethod("LeaveSession", QuizServiceServer.LeaveSession),
+		unaryMethod("GetSession", QuizServiceServer.GetSession),
+		unaryMethod("ListSessions", QuizServiceServer.ListSessions),
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "WatchEvents",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			request := new(WatchEventsRequest)
+			if err := stream.RecvMsg(request); err != nil {
+				return err
+			}
+			return srv.(QuizServiceServer).WatchEvents(request, eventSender{stream})
+		},
+	}},
+}
+
+func RegisterQuizServiceServer(registrar grpc.ServiceRegistrar, server QuizServiceServer) {
+	registrar.RegisterService(&ServiceDesc, server)
+}
+
+func fullMethod(name string) string {
+	return "/" + ServiceName + "/" + name
+}
+
+// unaryMethod describes a unary method calling the method of the server, through the server's
+// interceptor if it has one.
+func unaryMethod[Request, Response any](name string, call func(QuizServiceServer, context.Context, *Request) (*Response, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, decode func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			request := new(Request)
+			if err := decode(request); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, request interface{}) (interface{}, error) {
+				return call(srv.(QuizServiceServer), ctx, request.(*Request))
+			}
+			if interceptor == nil {
+				return handler(ctx, request)
+			}
+			return interceptor(ctx, request, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod(name)}, handler)
+		},
+	}
+}
+
+// Client calls the quiz service over a connection, using the JSON codec. Calls needing a player
+// token take it from the context, see WithToken.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+// WithToken returns a context whose calls carry a player token.
+func WithToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, authorizationKey, "Bearer "+token)
+}
+
+// ServiceKey authenticates the calls of an internal service to the server, which refuses calls
+// without its key. Pass it to grpc.WithPerRPCCredentials when dialing. The key is sent in the
+// clear without transport credentials, so use TLS outside of a trusted network.
+type ServiceKey string
+
+func (k ServiceKey) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{serviceKeyKey: string(k)}, nil
+}
+
+func (k ServiceKey) RequireTransportSecurity() bool {
+	return false
+}
+
+// ServiceKeyFromContext returns the service key of an incoming call.
+func ServiceKeyFromContext(ctx context.Context) string {
+	values := metadata.ValueFromIncomingContext(ctx, serviceKeyKey)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// TokenFromContext returns the player token of an incoming call.
+func TokenFromContext(ctx context.Context) string {
+	values := metadata.ValueFromIncomingContext(ctx, authorizationKey)
+	if len(values) == 0 {
+		return ""
+	}
+	token, _ := strings.CutPrefix(values[0], "Bearer ")
+	return token
+}
+
+func invoke[Response any](ctx context.Context, c *Client, method string, request interface{}, opts []grpc.CallOption) (*Response, error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(CodecName)}, opts...)
+	response := new(Response)
+	if err := c.conn.Invoke(ctx, fullMethod(method), request, response, opts...); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *Client) JoinSession(ctx context.Context, request *JoinSessionRequest, opts ...grpc.CallOption) (*protocol.JoinSessionResponse, error) {
+	return invoke[protocol.JoinSessionResponse](ctx, c, "JoinSession", request, opts)
+}
+
+func (c *Client) SpectateSession(ctx context.Context, request *protocol.SpectateSessionRequest, opts ...grpc.CallOption) (*protocol.JoinSessionResponse, error) {
+	return invoke[protocol.JoinSessionResponse](ctx, c, "SpectateSession", request, opts)
+}
+
+func (c *Client) SubmitAnswer(ctx context.Context, request *protocol.SubmitAnswerRequest, opts ...grpc.CallOption) (*protocol.SubmitAnswerResponse, error) {
+	return invoke[protocol.SubmitAnswerResponse](ctx, c, "SubmitAnswer", request, opts)
+}
+
+func (c *Client) LeaveSession(ctx context.Context, request *LeaveSessionRequest, opts ...grpc.CallOption) (*LeaveSessionResponse, error) {
+	return invoke[LeaveSessionResponse](ctx, c, "LeaveSession", request, opts)
+}
+
+func (c *Client) GetSession(ctx context.Context, request *GetSessionRequest, opts ...grpc.CallOption) (*SessionInfo, error) {
+	return invoke[SessionInfo](ctx, c, "GetSession", request, opts)
+}
+
+func (c *Client) ListSessions(ctx context.Context, request *ListSessionsRequest, opts ...grpc.CallOption) (*ListSessionsResponse, error) {
+	return invoke[ListSessionsResponse](ctx, c, "ListSessions", request, opts)
+}
+
+// WatchEvents streams the events of a session from when the call is made, until the session
+// ends or ctx is done.
+func (c *Client) WatchEvents(ctx context.Context, request *WatchEventsRequest, opts ...grpc.CallOption) (*EventStream, error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(CodecName)}, opts...)
+	stream, err := c.conn.NewStream(ctx, &ServiceDesc.Streams[0], fullMethod("WatchEvents"), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(request); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &EventStream{stream: stream}, nil
+}
+
+// EventStream receives the events of WatchEvents, Recv returns io.EOF once the session ended.
+type EventStream struct {
+	stream grpc.ClientStream
+}
+
+func (s *EventStream) Recv() (*Event, error) {
+	event := new(Event)
+	if err := s.stream.RecvMsg(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// ErrorCode returns the protocol error code of a rejected call, e.g. protocol.ErrorCodeSessionFull,
+// or "" if the server did not give one.
+func ErrorCode(err error) string {
+	for _, detail := range errorDetails(err) {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == ErrorDomain {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+// RetryDelay returns how long to wait before retrying a rejected call, if the server said.
+func RetryDelay(err error) (time.Duration, bool) {
+	for _, detail := range errorDetails(err) {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+			return info.RetryDelay.AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+func errorDetails(err error) []interface{} {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcErr) {
+		return nil
+	}
+	return grpcErr.GRPCStatus().Details()
+}
@@ -0,0 +1,359 @@
+package quiz_server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"the-quiz-game/pkg/protocol"
+	"time"
+)
+
+// DefaultRating is the rating of new accounts and of anonymous players when rating a session.
+const DefaultRating = 1000
+
+var (
+	ErrAccountNotFound    = errors.New("account not found")
+	ErrInvalidAccountKey  = errors.New("account key is invalid")
+	ErrAccountNameMissing = errors.New("account name is required")
+)
+
+// Account is a persistent player identity, so a name and rating follow a player between sessions.
+type Account struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Rating      int       `json:"rating"`
+	GamesPlayed int       `json:"gamesPlayed"`
+	CreatedAt   time.Time `json:"createdAt"`
+	keyHash     string
+}
+
+// response returns the public profile of the account.
+func (a Account) response() protocol.AccountResponse {
+	return protocol.AccountResponse{
+		ID:          a.ID,
+		Name:        a.Name,
+		Rating:      a.Rating,
+		GamesPlayed: a.GamesPlayed,
+		CreatedAt:   a.CreatedAt,
+	}
+}
+
+type AccountStore interface {
+	// CreateAccount creates an account and returns it with the secret key needed to use it.
+	CreateAccount(name string) (Account, string, error)
+	GetAccount(id string) (Account, error)
+	Authenticate(id, key string) (Account, error)
+	// ApplySessionResult updates the ratings of every account that took part in a session.
+	ApplySessionResult(result SessionResult) error
+}
+
+// storedAccount is the on disk representation of an Account, including its key hash.
+type storedAccount struct {
+	Account
+	KeyHash string `json:"keyHash"`
+}
+
+// FileAccountStore keeps every account in a single JSON file, rewritten on each change.
+type FileAccountStore struct {
+	path     string
+	mutex    sync.RWMutex
+	accounts map[string]Account
+}
+
+func NewFileAccountStore(path string) (*FileAccountStore, error) {
+	store := &FileAccountStore{
+		path:     path,
+		accounts: make(map[string]Account),
+	}
+
+	fileContent, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var accounts []storedAccount
+	if err := json.Unmarshal(fileContent, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to parse accounts file: %w", err)
+	}
+	for _, stored := range accounts {
+		account := stored.Account
+		account.keyHash = stored.KeyHash
+		store.accounts[account.ID] = account
+	}
+	return store, nil
+}
+
+func hashAccountKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// save writes every account to disk, the caller must hold the write lock.
+func (f *FileAccountStore) save() error {
+	accounts := make([]storedAccount, 0, len(f.accounts))
+	for _, account := range f.accounts {
+		accounts = append(accounts, storedAccount{Account: account, KeyHash: account.keyHash})
+	}
+	jsonData, err := json.MarshalIndent(accounts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+	tmpPath := f.path + ".tmp"
+	if err := os.WriteFile(tmpPath, jsonData, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, f.path)
+}
+
+func (f *FileAccountStore) CreateAccount(name string) (Account, string, error) {
+	account, key, err := newAccount(name)
+	if err != nil {
+		return Account{}, "", err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.accounts[account.ID] = account
+	if err := f.save(); err != nil {
+		delete(f.accounts, account.ID)
+		return Account{}, "", err
+	}
+	return account, key, nil
+}
+
+func (f *FileAccountStore) GetAccount(id string) (Account, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	account, ok := f.accounts[id]
+	if !ok {
+		return Account{}, ErrAccountNotFound
+	}
+	return account, nil
+}
+
+func (f *FileAccountStore) Authenticate(id, key string) (Account, error) {
+	account, err := f.GetAccount(id)
+	if err != nil {
+		return Account{}, err
+	}
+	return checkAccountKey(account, key)
+}
+
+// checkAccountKey returns the account if key is its key.
+func checkAccountKey(account Account, key string) (Account, error) {
+	if subtle.ConstantTimeCompare([]byte(account.keyHash), []byte(hashAccountKey(key))) != 1 {
+		return Account{}, ErrInvalidAccountKey
+	}
+	return account, nil
+}
+
+// newAccount returns a new account and its key.
+func newAccount(name string) (Account, string, error) {
+	if name == "" {
+		return Account{}, "", ErrAccountNameMissing
+	}
+	keyBytes := make([]byte, 24)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return Account{}, "", err
+	}
+	key := hex.EncodeToString(keyBytes)
+	return Account{
+		ID:        generateUniqueID(),
+		Name:      name,
+		Rating:    DefaultRating,
+		CreatedAt: time.Now(),
+		keyHash:   hashAccountKey(key),
+	}, key, nil
+}
+
+// ApplySessionResult rates the session as a series of pairwise Elo matches between its players.
+func (f *FileAccountStore) ApplySessionResult(result SessionResult) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	rated := rateSession(result, f.accounts)
+	if len(rated) == 0 {
+		return nil
+	}
+	for _, account := range rated {
+		f.accounts[account.ID] = account
+	}
+	return f.save()
+}
+
+// rateSession returns the accounts of a session's players with their ratings updated by the
+// session, rated as a series of pairwise Elo matches between its players. Players without an
+// account count as DefaultRating.
+func rateSession(result SessionResult, accounts map[string]Account) []Account {
+	if len(result.Players) < 2 {
+		return nil
+	}
+
+	ratings := make(map[string]float64)
+	for _, player := range result.Players {
+		ratings[player.ID] = DefaultRating
+		if account, ok := accounts[player.ID]; ok {
+			ratings[player.ID] = float64(account.Rating)
+		}
+	}
+
+	// Spread K over every opponent so a single game moves a rating as much as a 1v1 game would.
+	k := 32 / float64(len(result.Players)-1)
+	var rated []Account
+	for _, player := range result.Players {
+		account, ok := accounts[player.ID]
+		if !ok {
+			continue
+		}
+		delta := 0.0
+		for _, opponent := range result.Players {
+			if opponent.ID == player.ID {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, (ratings[opponent.ID]-ratings[player.ID])/400))
+			actual := 0.5
+			if player.Score > opponent.Score {
+				actual = 1
+			} else if player.Score < opponent.Score {
+				actual = 0
+			}
+			delta += k * (actual - expected)
+		}
+		account.Rating += int(math.Round(delta))
+		account.GamesPlayed++
+		rated = append(rated, account)
+	}
+	return rated
+}
+
+// DirAccountStore keeps each account in its own file of a directory, read on every lookup, so
+// the nodes of a cluster can share their accounts on a shared volume like FileRegistry. Files
+// are written atomically, an account playing on two nodes at once keeps the rating of the
+// session that ended last.
+type DirAccountStore struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+func NewDirAccountStore(dir string) (*DirAccountStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create accounts directory: %w", err)
+	}
+	return &DirAccountStore{dir: dir}, nil
+}
+
+func (d *DirAccountStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", ErrAccountNotFound
+	}
+	return filepath.Join(d.dir, id+".json"), nil
+}
+
+func (d *DirAccountStore) write(account Account) error {
+	path, err := d.path(account.ID)
+	if err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(storedAccount{Account: account, KeyHash: account.keyHash})
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, jsonData, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (d *DirAccountStore) CreateAccount(name string) (Account, string, error) {
+	account, key, err := newAccount(name)
+	if err != nil {
+		return Account{}, "", err
+	}
+	if err := d.write(account); err != nil {
+		return Account{}, "", err
+	}
+	return account, key, nil
+}
+
+func (d *DirAccountStore) GetAccount(id string) (Account, error) {
+	path, err := d.path(id)
+	if err != nil {
+		return Account{}, err
+	}
+	fileContent, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Account{}, ErrAccountNotFound
+	}
+	if err != nil {
+		return Account{}, err
+	}
+	var stored storedAccount
+	if err := json.Unmarshal(fileContent, &stored); err != nil {
+		return Account{}, fmt.Errorf("failed to parse account %s: %w", id, err)
+	}
+	account := stored.Account
+	account.keyHash = stored.KeyHash
+	return account, nil
+}
+
+func (d *DirAccountStore) Authenticate(id, key string) (Account, error) {
+	account, err := d.GetAccount(id)
+	if err != nil {
+		return Account{}, err
+	}
+	return checkAccountKey(account, key)
+}
+
+func (d *DirAccountStore) ApplySessionResult(result SessionResult) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	accounts := make(map[string]Account)
+	for _, player := range result.Players {
+		account, err := d.GetAccount(player.ID)
+		if errors.Is(err, ErrAccountNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		accounts[account.ID] = account
+	}
+	for _, account := range rateSession(result, accounts) {
+		if err := d.write(account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ratingResultsStore updates account ratings whenever a session result is saved.
+type ratingResultsStore struct {
+	ResultsStore
+	accounts AccountStore
+}
+
+func (r *ratingResultsStore) SaveSessionResult(result SessionResult) error {
+	if err := r.ResultsStore.SaveSessionResult(result); err != nil {
+		return err
+	}
+	if err := r.accounts.ApplySessionResult(result); err != nil {
+		fmt.Printf("Error updating account ratings: %v\n", err)
+	}
+	return nil
+}
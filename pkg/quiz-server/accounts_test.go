@@ -0,0 +1,51 @@
+package quiz_server
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+// Accounts created on one node must be usable on every node sharing the directory.
+func TestDirAccountStore_SharedBetweenNodes(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDirAccountStore(dir)
+	require.NoError(t, err)
+	alice, key, err := store.CreateAccount("Alice")
+	require.NoError(t, err)
+	bob, _, err := store.CreateAccount("Bob")
+	require.NoError(t, err)
+
+	other, err := NewDirAccountStore(dir)
+	require.NoError(t, err)
+	account, err := other.Authenticate(alice.ID, key)
+	require.NoError(t, err)
+	require.Equal(t, "Alice", account.Name)
+	_, err = other.Authenticate(alice.ID, "wrong")
+	require.ErrorIs(t, err, ErrInvalidAccountKey)
+	_, err = other.GetAccount("../accounts")
+	require.ErrorIs(t, err, ErrAccountNotFound)
+
+	require.NoError(t, other.ApplySessionResult(SessionResult{Players: []PlayerResult{
+		{ID: alice.ID, Score: 2},
+		{ID: bob.ID, Score: 1},
+	}}))
+	account, err = store.GetAccount(alice.ID)
+	require.NoError(t, err)
+	require.Equal(t, DefaultRating+16, account.Rating)
+	require.Equal(t, 1, account.GamesPlayed)
+}
+
+// Completed sessions are rated and saved, so a server cannot be created without both stores.
+func TestNewQuizServer_RequiresStores(t *testing.T) {
+	accounts, err := NewFileAccountStore(filepath.Join(t.TempDir(), "accounts.json"))
+	require.NoError(t, err)
+	results, err := NewFileResultsStore(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = NewQuizServer(context.Background(), QuizServerConfig{AccountStore: accounts})
+	require.Error(t, err)
+	_, err = NewQuizServer(context.Background(), QuizServerConfig{ResultsStore: results})
+	require.Error(t, err)
+}
@@ -0,0 +1,306 @@
+package quiz_server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"net/http"
+	"strconv"
+	"the-quiz-game/pkg/protocol"
+	quizRPC "the-quiz-game/pkg/quiz-rpc"
+	"time"
+)
+
+// ErrInvalidServiceKey rejects gRPC calls without the service key of the server.
+var ErrInvalidServiceKey = errors.New("service key is missing or invalid")
+
+// grpcCodes maps the HTTP statuses of errorStatuses to the codes of the gRPC API.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+	http.StatusMisdirectedRequest:    codes.FailedPrecondition,
+	http.StatusConflict:              codes.FailedPrecondition,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+	http.StatusGatewayTimeout:        codes.DeadlineExceeded,
+	http.StatusInternalServerError:   codes.Internal,
+}
+
+// grpcError converts the error of a call to a gRPC status, carrying the same error code as the
+// HTTP API in an ErrorInfo and, for errors that go away by themselves, a RetryInfo.
+func grpcError(err error) error {
+	errorStatus := statusFor(err)
+	grpcStatus := status.New(grpcCodes[errorStatus.status], errorStatus.message(err))
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: errorStatus.code, Domain: quizRPC.ErrorDomain}}
+	if seconds, err := strconv.Atoi(errorStatus.retryAfter); err == nil {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(time.Duration(seconds) * time.Second)})
+	}
+	if withDetails, err := grpcStatus.WithDetails(details...); err == nil {
+		grpcStatus = withDetails
+	}
+	return grpcStatus.Err()
+}
+
+// grpcService serves the gRPC API with the server's session manager, so players of both APIs
+// can play the same games.
+type grpcService struct {
+	qs *QuizServer
+}
+
+// GRPCServer returns a gRPC server serving the quiz service of quiz_rpc, the counterpart of
+// Handler for internal services. Every call must carry the service key of the server, calls
+// are all refused if it has none. Messages are limited to the size of request bodies.
+func (qs *QuizServer) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	service := grpcService{qs: qs}
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(service.authorizeUnary),
+		grpc.ChainStreamInterceptor(service.authorizeStream),
+	}, opts...)
+	if qs.rateLimits.MaxBodyBytes > 0 {
+		opts = append([]grpc.ServerOption{grpc.MaxRecvMsgSize(int(qs.rateLimits.MaxBodyBytes))}, opts...)
+	}
+	server := grpc.NewServer(opts...)
+	quizRPC.RegisterQuizServiceServer(server, service)
+	return server
+}
+
+// authorize checks the service key of a call.
+func (g grpcService) authorize(ctx context.Context) error {
+	key := quizRPC.ServiceKeyFromContext(ctx)
+	if len(g.qs.grpcServiceKey) == 0 || subtle.ConstantTimeCompare([]byte(key), g.qs.grpcServiceKey) != 1 {
+		return grpcError(ErrInvalidServiceKey)
+	}
+	return nil
+}
+
+func (g grpcService) authorizeUnary(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := g.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, request)
+}
+
+func (g grpcService) authorizeStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := g.authorize(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// verify returns the claims of the player token of a call.
+func (g grpcService) verify(ctx context.Context) (PlayerClaims, error) {
+	token := quizRPC.TokenFromContext(ctx)
+	if token == "" {
+		return PlayerClaims{}, ErrMissingToken
+	}
+	return g.qs.TokenIssuer.Verify(token)
+}
+
+// local checks that a session runs on this node, gRPC calls are not forwarded to other nodes.
+func (g grpcService) local(sessionId string) error {
+	if node, ok := g.qs.otherOwner(sessionId); ok {
+		return fmt.Errorf("%w: node %s at %s", ErrSessionOnOtherNode, node.ID, node.URL)
+	}
+	return nil
+}
+
+// validate checks a request like decodeRequest does for the HTTP API.
+func validate(request validator) error {
+	if err := request.Validate(); err != nil {
+		return grpcError(fmt.Errorf("%w: %w", ErrInvalidRequest, err))
+	}
+	return nil
+}
+
+func (g grpcService) JoinSession(ctx context.Context, request *quizRPC.JoinSessionRequest) (*protocol.JoinSessionResponse, error) {
+	if err := validate(request); err != nil {
+		return nil, err
+	}
+	sessionId := request.SessionId
+	if sessionId == protocol.AnySession {
+		sessionId = ""
+	}
+	if sessionId != "" {
+		if err := g.local(sessionId); err != nil {
+			return nil, grpcError(err)
+		}
+	}
+	// Internal services hold the service key, the sessions they create are not limited per client.
+	response, err := g.qs.join(ctx, sessionId, "", request.JoinSessionRequest)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &response, nil
+}
+
+func (g grpcService) SpectateSession(ctx context.Context, request *protocol.SpectateSessionRequest) (*protocol.JoinSessionResponse, error) {
+	if request.SessionId == "" {
+		return nil, grpcError(fmt.Errorf("%w: sessionId is required", ErrInvalidRequest))
+	}
+	if err := g.local(request.SessionId); err != nil {
+		return nil, grpcError(err)
+	}
+	response, err := g.qs.spectate(ctx, request.SessionId)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &response, nil
+}
+
+func (g grpcService) SubmitAnswer(ctx context.Context, request *protocol.SubmitAnswerRequest) (*protocol.SubmitAnswerResponse, error) {
+	claims, err := g.verify(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if err := validate(request); err != nil {
+		return nil, err
+	}
+	if request.SessionId == "" {
+		request.SessionId = claims.SessionID
+	}
+	if err := g.local(request.SessionId); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := g.qs.submitAnswer(ctx, claims, *request); err != nil {
+		return nil, grpcError(err)
+	}
+	return &protocol.SubmitAnswerResponse{Message: "Answer submitted successfully."}, nil
+}
+
+func (g grpcService) LeaveSession(ctx context.Context, request *quizRPC.LeaveSessionRequest) (*quizRPC.LeaveSessionResponse, error) {
+	claims, err := g.verify(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if request.SessionId == "" {
+		request.SessionId = claims.SessionID
+	}
+	if request.SessionId != claims.SessionID {
+		return nil, grpcError(ErrWrongSession)
+	}
+	if err := g.local(request.SessionId); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := g.qs.SessionManager.LeaveSession(request.SessionId, claims.PlayerID); err != nil {
+		return nil, grpcError(err)
+	}
+	return &quizRPC.LeaveSessionResponse{Message: "Left the session."}, nil
+}
+
+func (g grpcService) GetSession(ctx context.Context, request *quizRPC.GetSessionRequest) (*quizRPC.SessionInfo, error) {
+	if err := g.local(request.SessionId); err != nil {
+		return nil, grpcError(err)
+	}
+	session, ok := g.qs.SessionManager.Session(request.SessionId)
+	if !ok {
+		return nil, grpcError(ErrSessionNotFound)
+	}
+	info := session.info()
+	return &info, nil
+}
+
+// ListSessions returns the sessions running on this node.
+func (g grpcService) ListSessions(ctx context.Context, request *quizRPC.ListSessionsRequest) (*quizRPC.ListSessionsResponse, error) {
+	response := &quizRPC.ListSessionsResponse{Sessions: []quizRPC.SessionInfo{}}
+	for _, session := range g.qs.SessionManager.Sessions() {
+		response.Sessions = append(response.Sessions, session.info())
+	}
+	return response, nil
+}
+
+// WatchEvents streams the events of the session of the call's token, players and spectators
+// alike, until the session ends. Streams falling too far behind are ended with ResourceExhausted.
+func (g grpcService) WatchEvents(request *quizRPC.WatchEventsRequest, stream quizRPC.EventSender) error {
+	claims, err := g.verify(stream.Context())
+	if err != nil {
+		return grpcError(err)
+	}
+	if request.SessionId == "" {
+		request.SessionId = claims.SessionID
+	}
+	if request.SessionId != claims.SessionID {
+		return grpcError(ErrWrongSession)
+	}
+	if err := g.local(request.SessionId); err != nil {
+		return grpcError(err)
+	}
+	session, ok := g.qs.SessionManager.Session(request.SessionId)
+	if !ok {
+		return grpcError(ErrSessionNotFound)
+	}
+	subscription, unsubscribe, ok := session.subscribeEvents()
+	if !ok {
+		return grpcError(fmt.Errorf("session %s does not publish events", session.ID))
+	}
+	defer unsubscribe()
+
+	send := func(event sealedEvent) error {
+		return stream.Send(&quizRPC.Event{Name: event.name, Data: event.data})
+	}
+	for {
+		select {
+		case event, ok := <-subscription:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "fell too far behind the session's events")
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		case <-session.ctx.Done():
+			// The quiz-end event is published before the session ends, send what is left.
+			for {
+				select {
+				case event, ok := <-subscription:
+					if !ok {
+						return nil
+					}
+					if err := send(event); err != nil {
+						return err
+					}
+				default:
+					return nil
+				}
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// info returns the state of the session for the gRPC API.
+func (s *Session) info() quizRPC.SessionInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := quizRPC.SessionInfo{
+		SessionId:       s.ID,
+		State:           string(SessionWaiting),
+		Players:         make([]quizRPC.SessionPlayer, 0, len(s.players)),
+		MaxPlayers:      int32(s.maxPlayersPerSession),
+		Spectators:      int32(s.spectators),
+		CurrentQuestion: int32(s.currentQuestion),
+		QuestionCount:   int32(len(s.questions)),
+	}
+	if s.started {
+		info.State = string(SessionInProgress)
+	}
+	ranked, _ := rankPlayers(s.players)
+	for _, player := range ranked {
+		info.Players = append(info.Players, quizRPC.SessionPlayer{
+			PlayerId: player.ID,
+			Name:     player.Name,
+			Score:    int32(player.Score),
+			Left:     player.left,
+		})
+	}
+	return info
+}
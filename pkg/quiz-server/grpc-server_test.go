@@ -0,0 +1,153 @@
+package quiz_server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"the-quiz-game/pkg/events"
+	"the-quiz-game/pkg/protocol"
+	quizRPC "the-quiz-game/pkg/quiz-rpc"
+	"the-quiz-game/pkg/signing"
+	"time"
+)
+
+// newTestGRPCClient serves the gRPC API of qs over an in-memory connection.
+func newTestGRPCClient(t *testing.T, qs *QuizServer) *quizRPC.Client {
+	return newTestGRPCClientWithKey(t, qs, "service-key")
+}
+
+func newTestGRPCClientWithKey(t *testing.T, qs *QuizServer, key quizRPC.ServiceKey) *quizRPC.Client {
+	listener := bufconn.Listen(1 << 20)
+	server := qs.GRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(key))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return quizRPC.NewClient(conn)
+}
+
+func newTestQuizServer(t *testing.T) *QuizServer {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer := signing.NewSigner(privateKey)
+	return &QuizServer{
+		SessionManager: NewSessionManager(SessionManagerConfig{
+			MaxSessions:          1,
+			MaxPlayersPerSession: 3,
+			AblyConnection:       newTestAblyConnection(t),
+			Questions:            []Question{{Question: "2 + 2?", PossibleAnswers: []string{"3", "4"}, CorrectAnswer: 1}},
+			EventSigner:          signer,
+		}),
+		TokenIssuer:    NewTokenIssuer([]byte("secret"), time.Hour),
+		eventSigner:    signer,
+		commandTimeout: time.Second,
+		grpcServiceKey: []byte("service-key"),
+	}
+}
+
+// Players of the gRPC and HTTP APIs must join the same sessions, and leave them over gRPC.
+func TestGRPCService_JoinAndLeave(t *testing.T) {
+	qs := newTestQuizServer(t)
+	client := newTestGRPCClient(t, qs)
+	ctx := context.Background()
+
+	alice, err := client.JoinSession(ctx, &quizRPC.JoinSessionRequest{JoinSessionRequest: protocol.JoinSessionRequest{PlayerName: "Alice"}})
+	require.NoError(t, err)
+
+	body, err := json.Marshal(protocol.JoinSessionRequest{PlayerName: "Bob"})
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	qs.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, protocol.SessionPath(alice.SessionId, protocol.SessionPlayers), bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	info, err := client.GetSession(ctx, &quizRPC.GetSessionRequest{SessionId: alice.SessionId})
+	require.NoError(t, err)
+	require.Equal(t, string(SessionWaiting), info.State)
+	require.Len(t, info.Players, 2)
+
+	_, err = client.LeaveSession(quizRPC.WithToken(ctx, alice.Token), &quizRPC.LeaveSessionRequest{})
+	require.NoError(t, err)
+	list, err := client.ListSessions(ctx, &quizRPC.ListSessionsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Sessions, 1)
+	require.Len(t, list.Sessions[0].Players, 1)
+	require.Equal(t, "Bob", list.Sessions[0].Players[0].Name)
+
+	_, err = client.LeaveSession(quizRPC.WithToken(ctx, alice.Token), &quizRPC.LeaveSessionRequest{})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Equal(t, protocol.ErrorCodePlayerNotFound, quizRPC.ErrorCode(err))
+
+	_, err = client.JoinSession(ctx, &quizRPC.JoinSessionRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, protocol.ErrorCodeInvalidRequest, quizRPC.ErrorCode(err))
+	_, err = client.SubmitAnswer(ctx, &protocol.SubmitAnswerRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// Calls without the service key of the server must be refused, so only internal services can
+// read sessions and take their slots.
+func TestGRPCService_RequiresServiceKey(t *testing.T) {
+	qs := newTestQuizServer(t)
+	for _, key := range []quizRPC.ServiceKey{"", "wrong"} {
+		client := newTestGRPCClientWithKey(t, qs, key)
+		_, err := client.ListSessions(context.Background(), &quizRPC.ListSessionsRequest{})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.Equal(t, protocol.ErrorCodeUnauthorized, quizRPC.ErrorCode(err))
+		stream, err := client.WatchEvents(context.Background(), &quizRPC.WatchEventsRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+}
+
+// The event stream must deliver the signed events the session publishes, until it ends.
+func TestGRPCService_WatchEvents(t *testing.T) {
+	qs := newTestQuizServer(t)
+	client := newTestGRPCClient(t, qs)
+	channel := newSignedChannel(discardChannel{}, qs.eventSigner, "session1")
+	sessionCtx, cancel := context.WithCancel(context.Background())
+	session := NewSession("session1", SessionConfig{maxPlayersPerSession: 2}, nil, channel, cancel, sessionCtx)
+	qs.SessionManager.directory.add(session)
+
+	token, _, err := qs.TokenIssuer.IssueSpectator("spectator1", "session1")
+	require.NoError(t, err)
+	stream, err := client.WatchEvents(quizRPC.WithToken(context.Background(), token), &quizRPC.WatchEventsRequest{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		channel.mutex.Lock()
+		defer channel.mutex.Unlock()
+		return len(channel.subscribers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, channel.Publish(context.Background(), string(events.QuizEnd), events.QuizEndPayload{Message: endedMessage}))
+	cancel()
+
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	verifier, err := events.NewVerifier(qs.eventSigner.PublicKey(), "session1")
+	require.NoError(t, err)
+	envelope, err := verifier.Open(event.Name, event.Data)
+	require.NoError(t, err)
+	require.Equal(t, events.QuizEnd, envelope.Type)
+	_, err = stream.Recv()
+	require.ErrorIs(t, err, io.EOF)
+}
@@ -1,7 +1,155 @@
 package quiz_server
 
-import "github.com/google/uuid"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"the-quiz-game/pkg/protocol"
+)
 
 func generateUniqueID() string {
 	return uuid.New().String()
 }
+
+// writeJSON marshals v and writes it as a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, protocol.ErrorCodeInternal, "Failed to marshal response.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(bytes); err != nil {
+		fmt.Printf("Error writing response: %s\n", err)
+	}
+}
+
+// ErrInvalidRequest is returned for requests failing validation.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// validator is implemented by the requests of the protocol package that check their fields.
+type validator interface {
+	Validate() error
+}
+
+// decodeRequest decodes a JSON request body into v, rejecting fields the API does not define,
+// and validates it. Invalid requests are answered here, it reports whether v can be used.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeErrorFor(w, ErrRequestTooLarge)
+		return false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, protocol.ErrorCodeInvalidRequest, "Failed to parse request body: "+err.Error())
+		return false
+	}
+	if request, ok := v.(validator); ok {
+		if err := request.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, protocol.ErrorCodeInvalidRequest, err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+// writeError writes an error response with a machine-readable code.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	bytes, err := json.Marshal(protocol.ErrorResponse{Code: code, Message: message})
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(bytes); err != nil {
+		fmt.Printf("Error writing response: %s\n", err)
+	}
+}
+
+// errorStatus is the response to requests failing with a typed error of the package.
+type errorStatus struct {
+	err    error
+	status int
+	code   string
+	// retryAfter is the Retry-After header, in seconds, for errors that go away by themselves.
+	retryAfter string
+}
+
+var errorStatuses = []errorStatus{
+	{err: ErrAnswerOutOfRange, status: http.StatusBadRequest, code: protocol.ErrorCodeInvalidAnswer},
+	{err: ErrInvalidRequest, status: http.StatusBadRequest, code: protocol.ErrorCodeInvalidRequest},
+	{err: ErrAccountNameMissing, status: http.StatusBadRequest, code: protocol.ErrorCodeInvalidRequest},
+	{err: ErrRequestTooLarge, status: http.StatusRequestEntityTooLarge, code: protocol.ErrorCodeRequestTooLarge},
+	{err: ErrMissingToken, status: http.StatusUnauthorized, code: protocol.ErrorCodeUnauthorized},
+	{err: ErrInvalidToken, status: http.StatusUnauthorized, code: protocol.ErrorCodeUnauthorized},
+	{err: ErrTokenExpired, status: http.StatusUnauthorized, code: protocol.ErrorCodeUnauthorized},
+	{err: ErrInvalidAccountKey, status: http.StatusUnauthorized, code: protocol.ErrorCodeUnauthorized},
+	{err: ErrInvalidServiceKey, status: http.StatusUnauthorized, code: protocol.ErrorCodeUnauthorized},
+	{err: ErrWrongSession, status: http.StatusForbidden, code: protocol.ErrorCodeForbidden},
+	{err: ErrSpectatorAnswer, status: http.StatusForbidden, code: protocol.ErrorCodeForbidden},
+	{err: ErrSessionNotFound, status: http.StatusNotFound, code: protocol.ErrorCodeSessionNotFound},
+	{err: ErrResultNotFound, status: http.StatusNotFound, code: protocol.ErrorCodeSessionNotFound},
+	{err: ErrPlayerNotFound, status: http.StatusNotFound, code: protocol.ErrorCodePlayerNotFound},
+	{err: ErrAccountNotFound, status: http.StatusNotFound, code: protocol.ErrorCodeAccountNotFound},
+	{err: ErrSessionOnOtherNode, status: http.StatusMisdirectedRequest, code: protocol.ErrorCodeWrongNode},
+	{err: ErrAlreadyAnswered, status: http.StatusConflict, code: protocol.ErrorCodeAlreadyAnswered},
+	{err: ErrWrongQuestion, status: http.StatusConflict, code: protocol.ErrorCodeWrongQuestion},
+	{err: ErrNoActiveQuestion, status: http.StatusConflict, code: protocol.ErrorCodeNoActiveQuestion},
+	{err: ErrLateAnswer, status: http.StatusConflict, code: protocol.ErrorCodeLateAnswer},
+	{err: ErrSessionFull, status: http.StatusConflict, code: protocol.ErrorCodeSessionFull},
+	{err: ErrTooManySessions, status: http.StatusTooManyRequests, code: protocol.ErrorCodeTooManySessions, retryAfter: "5"},
+	{err: ErrRateLimited, status: http.StatusTooManyRequests, code: protocol.ErrorCodeRateLimited, retryAfter: "1"},
+	{err: ErrClientSessionLimit, status: http.StatusTooManyRequests, code: protocol.ErrorCodeRateLimited, retryAfter: "5"},
+	{err: ErrShuttingDown, status: http.StatusServiceUnavailable, code: protocol.ErrorCodeShuttingDown},
+	{err: ErrSessionBusy, status: http.StatusServiceUnavailable, code: protocol.ErrorCodeBusy, retryAfter: "1"},
+	{err: ErrCommandNotAccepted, status: http.StatusServiceUnavailable, code: protocol.ErrorCodeBusy, retryAfter: "1"},
+	{err: ErrCommandTimeout, status: http.StatusGatewayTimeout, code: protocol.ErrorCodeTimeout},
+}
+
+// statusFor returns the response to a request that failed with err, the status of its typed
+// error or a 500 for any other error.
+func statusFor(err error) errorStatus {
+	for _, errorStatus := range errorStatuses {
+		if errors.Is(err, errorStatus.err) {
+			var rateLimitErr *RateLimitError
+			if errors.As(err, &rateLimitErr) {
+				errorStatus.retryAfter = rateLimitErr.retryAfterSeconds()
+			}
+			return errorStatus
+		}
+	}
+	fmt.Printf("Error handling request: %v\n", err)
+	return errorStatus{err: err, status: http.StatusInternalServerError, code: protocol.ErrorCodeInternal}
+}
+
+// message returns the message sent for err. Errors that are not typed errors of the package
+// are only logged, their message could reveal internal details.
+func (e errorStatus) message(err error) string {
+	if e.status == http.StatusInternalServerError {
+		return "Internal server error."
+	}
+	return err.Error()
+}
+
+// writeErrorFor answers a request that failed with err, with the status and error code of its
+// typed error. Any other error is a 500.
+func writeErrorFor(w http.ResponseWriter, err error) {
+	errorStatus := statusFor(err)
+	if errorStatus.retryAfter != "" {
+		w.Header().Set("Retry-After", errorStatus.retryAfter)
+	}
+	writeError(w, errorStatus.status, errorStatus.code, errorStatus.message(err))
+}
+
+// writeMethodNotAllowed answers requests made with a method the endpoint does not support.
+func writeMethodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, protocol.ErrorCodeMethodNotAllowed, "Method not allowed.")
+}
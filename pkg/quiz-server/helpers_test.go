@@ -0,0 +1,41 @@
+package quiz_server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"the-quiz-game/pkg/protocol"
+)
+
+// Typed errors, even wrapped, must be answered with their status and a stable error code.
+func TestWriteErrorFor(t *testing.T) {
+	tests := []struct {
+		err        error
+		status     int
+		code       string
+		retryAfter string
+		message    string
+	}{
+		{ErrSessionNotFound, http.StatusNotFound, protocol.ErrorCodeSessionNotFound, "", ErrSessionNotFound.Error()},
+		{ErrAlreadyAnswered, http.StatusConflict, protocol.ErrorCodeAlreadyAnswered, "", ErrAlreadyAnswered.Error()},
+		{ErrTooManySessions, http.StatusTooManyRequests, protocol.ErrorCodeTooManySessions, "5", ErrTooManySessions.Error()},
+		{ErrShuttingDown, http.StatusServiceUnavailable, protocol.ErrorCodeShuttingDown, "", ErrShuttingDown.Error()},
+		{fmt.Errorf("%w: context deadline exceeded", ErrCommandTimeout), http.StatusGatewayTimeout, protocol.ErrorCodeTimeout, "", ErrCommandTimeout.Error() + ": context deadline exceeded"},
+		// Other errors are only logged, the client gets a generic message.
+		{errors.New("disk full"), http.StatusInternalServerError, protocol.ErrorCodeInternal, "", "Internal server error."},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		writeErrorFor(recorder, test.err)
+
+		require.Equal(t, test.status, recorder.Code, test.err)
+		require.Equal(t, test.retryAfter, recorder.Header().Get("Retry-After"), test.err)
+		var response protocol.ErrorResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		require.Equal(t, protocol.ErrorResponse{Code: test.code, Message: test.message}, response)
+	}
+}
@@ -0,0 +1,166 @@
+package quiz_server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"the-quiz-game/pkg/events"
+	"time"
+)
+
+// LeaderboardChannelName is the realtime channel leaderboard change events are published on.
+const LeaderboardChannelName = "leaderboard"
+
+type LeaderboardPeriod string
+
+const (
+	AllTimeLeaderboard LeaderboardPeriod = "all-time"
+	WeeklyLeaderboard  LeaderboardPeriod = "weekly"
+	DailyLeaderboard   LeaderboardPeriod = "daily"
+)
+
+var LeaderboardPeriods = []LeaderboardPeriod{AllTimeLeaderboard, WeeklyLeaderboard, DailyLeaderboard}
+
+// LeaderboardEntry is the aggregated standing of a single player over a period.
+type LeaderboardEntry struct {
+	Rank              int    `json:"rank"`
+	PlayerID          string `json:"playerId"`
+	Name              string `json:"name"`
+	Score             int    `json:"score"`
+	SessionsPlayed    int    `json:"sessionsPlayed"`
+	TotalAnswerTimeMs int64  `json:"totalAnswerTimeMs"`
+}
+
+// LeaderboardPage is a single page of a leaderboard.
+type LeaderboardPage struct {
+	Period   LeaderboardPeriod  `json:"period"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"pageSize"`
+	Total    int                `json:"total"`
+	Entries  []LeaderboardEntry `json:"entries"`
+}
+
+// Leaderboards wraps a ResultsStore and derives all-time, weekly and daily leaderboards from it.
+// Saving a result through Leaderboards publishes a "leaderboard-changed" event.
+type Leaderboards struct {
+	ResultsStore
+	publishChannel RealtimeChannel
+	now            func() time.Time
+}
+
+func NewLeaderboards(store ResultsStore, publishChannel RealtimeChannel) *Leaderboards {
+	return &Leaderboards{
+		ResultsStore:   store,
+		publishChannel: publishChannel,
+		now:            time.Now,
+	}
+}
+
+func (l *Leaderboards) SaveSessionResult(result SessionResult) error {
+	if err := l.ResultsStore.SaveSessionResult(result); err != nil {
+		return err
+	}
+	l.publishLeaderboardChanged(result.SessionID)
+	return nil
+}
+
+func (l *Leaderboards) publishLeaderboardChanged(sessionId string) {
+	if l.publishChannel == nil {
+		return
+	}
+	payload := events.LeaderboardChangedPayload{SessionID: sessionId}
+	for _, period := range LeaderboardPeriods {
+		payload.Periods = append(payload.Periods, string(period))
+	}
+	if err := l.publishChannel.Publish(context.Background(), string(events.LeaderboardChanged), payload); err != nil {
+		fmt.Printf("Error publishing leaderboard change: %v\n", err)
+	}
+}
+
+// periodStart returns the earliest session end time included in the period, all times are UTC.
+func (l *Leaderboards) periodStart(period LeaderboardPeriod) (time.Time, error) {
+	now := l.now().UTC()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case AllTimeLeaderboard:
+		return time.Time{}, nil
+	case DailyLeaderboard:
+		return startOfDay, nil
+	case WeeklyLeaderboard:
+		// Weeks start on Monday.
+		daysSinceMonday := (int(now.Weekday()) + 6) % 7
+		return startOfDay.AddDate(0, 0, -daysSinceMonday), nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown leaderboard period %q", period)
+	}
+}
+
+// GetLeaderboard returns a page of the leaderboard for a period, pages start at 1.
+// Players are ranked by total score, ties are broken by the lowest total answer time.
+func (l *Leaderboards) GetLeaderboard(period LeaderboardPeriod, page, pageSize int) (LeaderboardPage, error) {
+	if page < 1 || pageSize < 1 {
+		return LeaderboardPage{}, fmt.Errorf("page and page size must be 1 or higher")
+	}
+	since, err := l.periodStart(period)
+	if err != nil {
+		return LeaderboardPage{}, err
+	}
+	results, err := l.ListSessionResults(since)
+	if err != nil {
+		return LeaderboardPage{}, err
+	}
+
+	// Results are ordered oldest first, so the latest name a player used wins.
+	entries := make(map[string]*LeaderboardEntry)
+	for _, result := range results {
+		for _, player := range result.Players {
+			entry, ok := entries[player.ID]
+			if !ok {
+				entry = &LeaderboardEntry{PlayerID: player.ID}
+				entries[player.ID] = entry
+			}
+			entry.Name = player.Name
+			entry.Score += player.Score
+			entry.SessionsPlayed++
+		}
+		for _, answer := range result.Answers {
+			if entry, ok := entries[answer.PlayerID]; ok {
+				entry.TotalAnswerTimeMs += answer.ResponseTimeMs
+			}
+		}
+	}
+
+	ranked := make([]LeaderboardEntry, 0, len(entries))
+	for _, entry := range entries {
+		ranked = append(ranked, *entry)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		if ranked[i].TotalAnswerTimeMs != ranked[j].TotalAnswerTimeMs {
+			return ranked[i].TotalAnswerTimeMs < ranked[j].TotalAnswerTimeMs
+		}
+		return ranked[i].PlayerID < ranked[j].PlayerID
+	})
+	for i := range ranked {
+		ranked[i].Rank = i + 1
+	}
+
+	leaderboardPage := LeaderboardPage{
+		Period:   period,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    len(ranked),
+		Entries:  make([]LeaderboardEntry, 0),
+	}
+	start := (page - 1) * pageSize
+	if start < len(ranked) {
+		end := start + pageSize
+		if end > len(ranked) {
+			end = len(ranked)
+		}
+		leaderboardPage.Entries = ranked[start:end]
+	}
+	return leaderboardPage, nil
+}
@@ -0,0 +1,68 @@
+package quiz_server
+
+import (
+	"context"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// Players with equal scores are ranked by total answer time, and periods only include recent sessions.
+func TestLeaderboards_GetLeaderboard(t *testing.T) {
+	store, err := NewFileResultsStore(t.TempDir())
+	require.NoError(t, err)
+
+	mockChannel := new(MockRealtimeChannel)
+	mockChannel.On("Publish", context.Background(), "leaderboard-changed", mock.Anything).Return(nil)
+
+	leaderboards := NewLeaderboards(store, mockChannel)
+	// Wednesday, so the weekly leaderboard starts on Monday the 13th.
+	now := time.Date(2023, time.November, 15, 12, 0, 0, 0, time.UTC)
+	leaderboards.now = func() time.Time { return now }
+
+	require.NoError(t, leaderboards.SaveSessionResult(SessionResult{
+		SessionID: "last-week",
+		EndedAt:   now.AddDate(0, 0, -7),
+		Players:   []PlayerResult{{ID: "1", Name: "Alice", Score: 5}},
+	}))
+	require.NoError(t, leaderboards.SaveSessionResult(SessionResult{
+		SessionID: "monday",
+		EndedAt:   now.AddDate(0, 0, -2),
+		Players: []PlayerResult{
+			{ID: "2", Name: "Bob", Score: 2},
+			{ID: "3", Name: "Carol", Score: 2},
+		},
+		Answers: []AnswerRecord{
+			{PlayerID: "2", ResponseTimeMs: 900},
+			{PlayerID: "3", ResponseTimeMs: 400},
+		},
+	}))
+	require.NoError(t, leaderboards.SaveSessionResult(SessionResult{
+		SessionID: "today",
+		EndedAt:   now.Add(-time.Hour),
+		Players:   []PlayerResult{{ID: "2", Name: "Bobby", Score: 1}},
+	}))
+	mockChannel.AssertNumberOfCalls(t, "Publish", 3)
+
+	allTime, err := leaderboards.GetLeaderboard(AllTimeLeaderboard, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, []LeaderboardEntry{
+		{Rank: 1, PlayerID: "1", Name: "Alice", Score: 5, SessionsPlayed: 1},
+		{Rank: 2, PlayerID: "2", Name: "Bobby", Score: 3, SessionsPlayed: 2, TotalAnswerTimeMs: 900},
+		{Rank: 3, PlayerID: "3", Name: "Carol", Score: 2, SessionsPlayed: 1, TotalAnswerTimeMs: 400},
+	}, allTime.Entries)
+
+	weekly, err := leaderboards.GetLeaderboard(WeeklyLeaderboard, 2, 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, weekly.Total)
+	require.Equal(t, []LeaderboardEntry{
+		{Rank: 2, PlayerID: "3", Name: "Carol", Score: 2, SessionsPlayed: 1, TotalAnswerTimeMs: 400},
+	}, weekly.Entries)
+
+	daily, err := leaderboards.GetLeaderboard(DailyLeaderboard, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, []LeaderboardEntry{
+		{Rank: 1, PlayerID: "2", Name: "Bobby", Score: 1, SessionsPlayed: 1},
+	}, daily.Entries)
+}
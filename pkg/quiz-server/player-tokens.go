@@ -0,0 +1,145 @@
+package quiz_server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingToken = errors.New("player token is required")
+	ErrInvalidToken = errors.New("player token is invalid")
+	ErrTokenExpired = errors.New("player token has expired")
+	// ErrWrongSession and ErrSpectatorAnswer reject valid tokens used for what they do not allow.
+	ErrWrongSession    = errors.New("player token was not issued for this session")
+	ErrSpectatorAnswer = errors.New("spectators cannot submit answers")
+)
+
+// PlayerClaims identify the player a token was issued to and the session they joined.
+// Spectator tokens only allow watching the session.
+type PlayerClaims struct {
+	PlayerID  string `json:"playerId"`
+	SessionID string `json:"sessionId"`
+	Spectator bool   `json:"spectator,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// TokenIssuer issues and verifies HMAC signed player tokens. A token is the base64 encoded
+// JSON claims and the base64 encoded signature of those claims joined by a dot.
+type TokenIssuer struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewTokenIssuer(secret []byte, ttl time.Duration) *TokenIssuer {
+	return &TokenIssuer{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// NewRandomTokenSecret generates a secret for servers that were not given one, tokens signed
+// with it stop working when the server restarts.
+func NewRandomTokenSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// LoadOrCreateTokenSecret reads the secret saved at path, generating and saving a new one if the
+// file does not exist yet, so tokens keep working when the server restarts.
+func LoadOrCreateTokenSecret(path string) ([]byte, error) {
+	fileContent, err := os.ReadFile(path)
+	if err == nil {
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(fileContent)))
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("%s does not contain a token secret", path)
+		}
+		return secret, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	secret, err := NewRandomTokenSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(secret)+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (t *TokenIssuer) sign(payload string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issue creates a token for a player in a session, returning the token and when it expires.
+func (t *TokenIssuer) Issue(playerId, sessionId string) (string, time.Time, error) {
+	return t.issue(PlayerClaims{PlayerID: playerId, SessionID: sessionId})
+}
+
+// IssueSpectator creates a token for a spectator watching a session.
+func (t *TokenIssuer) IssueSpectator(spectatorId, sessionId string) (string, time.Time, error) {
+	return t.issue(PlayerClaims{PlayerID: spectatorId, SessionID: sessionId, Spectator: true})
+}
+
+func (t *TokenIssuer) issue(playerClaims PlayerClaims) (string, time.Time, error) {
+	expiresAt := t.now().Add(t.ttl)
+	playerClaims.ExpiresAt = expiresAt.Unix()
+	claims, err := json.Marshal(playerClaims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + t.sign(payload), expiresAt, nil
+}
+
+// Verify checks the signature and expiry of a token and returns its claims.
+func (t *TokenIssuer) Verify(token string) (PlayerClaims, error) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(t.sign(payload))) {
+		return PlayerClaims{}, ErrInvalidToken
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return PlayerClaims{}, ErrInvalidToken
+	}
+	var claims PlayerClaims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return PlayerClaims{}, ErrInvalidToken
+	}
+	if t.now().Unix() >= claims.ExpiresAt {
+		return PlayerClaims{}, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+// VerifyRequest verifies the bearer token in the Authorization header of a request.
+func (t *TokenIssuer) VerifyRequest(r *http.Request) (PlayerClaims, error) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return PlayerClaims{}, ErrMissingToken
+	}
+	return t.Verify(token)
+}
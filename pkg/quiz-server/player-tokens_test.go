@@ -0,0 +1,66 @@
+package quiz_server
+
+import (
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Tokens must round trip, and be rejected once tampered with or expired.
+func TestTokenIssuer_Verify(t *testing.T) {
+	issuer := NewTokenIssuer([]byte("secret"), time.Minute)
+	now := time.Now()
+	issuer.now = func() time.Time { return now }
+
+	token, expiresAt, err := issuer.Issue("player1", "session1")
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Minute), expiresAt)
+
+	claims, err := issuer.Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, "player1", claims.PlayerID)
+	require.Equal(t, "session1", claims.SessionID)
+
+	_, err = NewTokenIssuer([]byte("other secret"), time.Minute).Verify(token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = issuer.Verify("garbage")
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	issuer.now = func() time.Time { return now.Add(2 * time.Minute) }
+	_, err = issuer.Verify(token)
+	require.ErrorIs(t, err, ErrTokenExpired)
+}
+
+// Spectator tokens must be told apart from player tokens.
+func TestTokenIssuer_IssueSpectator(t *testing.T) {
+	issuer := NewTokenIssuer([]byte("secret"), time.Minute)
+
+	token, _, err := issuer.IssueSpectator("spectator1", "session1")
+	require.NoError(t, err)
+	claims, err := issuer.Verify(token)
+	require.NoError(t, err)
+	require.True(t, claims.Spectator)
+	require.Equal(t, "session1", claims.SessionID)
+
+	token, _, err = issuer.Issue("player1", "session1")
+	require.NoError(t, err)
+	claims, err = issuer.Verify(token)
+	require.NoError(t, err)
+	require.False(t, claims.Spectator)
+}
+
+// A generated secret must be saved, so tokens issued before a restart verify after it.
+func TestLoadOrCreateTokenSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token-secret")
+	created, err := LoadOrCreateTokenSecret(path)
+	require.NoError(t, err)
+	token, _, err := NewTokenIssuer(created, time.Minute).Issue("player1", "session1")
+	require.NoError(t, err)
+
+	loaded, err := LoadOrCreateTokenSecret(path)
+	require.NoError(t, err)
+	_, err = NewTokenIssuer(loaded, time.Minute).Verify(token)
+	require.NoError(t, err)
+}
@@ -1,11 +1,19 @@
 package quiz_server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/ably/ably-go/ably"
+	"io"
 	"net/http"
+	"strconv"
+	"the-quiz-game/pkg/events"
+	"the-quiz-game/pkg/protocol"
+	"the-quiz-game/pkg/signing"
+	"time"
 )
 
 // QuizServer represents the main structure for the quiz server application.
@@ -16,133 +24,553 @@ type QuizServer struct {
 	ServerChannel        ably.RealtimeChannel
 	MaxSessionCount      int
 	MaxPlayersPerSession int
+	ResultsStore         ResultsStore
+	Leaderboards         *Leaderboards
+	AccountStore         AccountStore
+	TokenIssuer          *TokenIssuer
+	ablyClient           *ably.Realtime
+	ablyTokenTTL         time.Duration
+	eventSigner          *signing.Signer
+	registry             SessionRegistry
+	nodeID               string
+	commandTimeout       time.Duration
+	rateLimits           RateLimits
+	clientLimiter        *rateLimiter
+	answerLimiter        *rateLimiter
+	grpcServiceKey       []byte
 }
 
+// QuizServerConfig holds everything needed to create a QuizServer.
+type QuizServerConfig struct {
+	MaxSessionCount      int
+	MaxPlayersPerSession int
+	AblyPrivateKey       string
+	// ResultsStore saves the results of completed sessions and AccountStore the ratings of the
+	// accounts that played them, both are required.
+	ResultsStore ResultsStore
+	AccountStore AccountStore
+	TokenIssuer  *TokenIssuer
+	// AblyTokenTTL is how long the realtime tokens handed to players are valid for.
+	AblyTokenTTL time.Duration
+	// EventSigner signs every event published on session channels.
+	EventSigner *signing.Signer
+	// HideStandingsQuestions is the number of final questions after which no standings are shown.
+	HideStandingsQuestions int
+	// SnapshotStore keeps the state of sessions every SnapshotInterval so they survive a restart,
+	// sessions are not snapshotted if it is nil.
+	SnapshotStore    SnapshotStore
+	SnapshotInterval time.Duration
+	// AnswerQueueSize is how many answers each session queues, answers beyond it are refused
+	// with 503 until the session catches up.
+	AnswerQueueSize int
+	// CommandTimeout bounds how long a request waits for its session command to be handled, on
+	// top of the request's own deadline. It defaults to DefaultCommandTimeout.
+	CommandTimeout time.Duration
+	// Registry is shared by every node of a cluster, requests for sessions owned by another
+	// node are forwarded to it. Node is this server, as the other nodes reach it. The server
+	// runs on its own if Registry is nil.
+	Registry SessionRegistry
+	Node     Node
+	// WaitingRoomTimeout ends waiting rooms nobody joined for that long, freeing their slot, and
+	// MaxSessionLifetime ends sessions that ran for that long. Zero disables them.
+	WaitingRoomTimeout time.Duration
+	MaxSessionLifetime time.Duration
+	// RateLimits protect the server from clients flooding it, see DefaultRateLimits. Nothing is
+	// limited if it is left empty.
+	RateLimits RateLimits
+	// GRPCServiceKey authenticates the internal services calling the gRPC API, see
+	// quiz_rpc.ServiceKey. Every gRPC call is refused if it is empty.
+	GRPCServiceKey string
+}
+
+// DefaultCommandTimeout is how long requests wait for their session command when not configured.
+const DefaultCommandTimeout = 5 * time.Second
+
 // NewQuizServer initializes a new QuizServer instance.
-func NewQuizServer(ctx context.Context, maxSessionCount, maxPlayersPerSession int, ablyPrivateKey string) (*QuizServer, error) {
+func NewQuizServer(ctx context.Context, config QuizServerConfig) (*QuizServer, error) {
+	if config.ResultsStore == nil || config.AccountStore == nil {
+		return nil, errors.New("a results store and an account store are required")
+	}
 	commandChan := make(chan interface{})
 
-	ablyClient, err := ably.NewRealtime(ably.WithKey(ablyPrivateKey))
+	ablyClient, err := ably.NewRealtime(ably.WithKey(config.AblyPrivateKey))
 	if err != nil {
 		return nil, err
 	}
 
+	if config.Registry != nil {
+		if err := config.Registry.RegisterNode(config.Node); err != nil {
+			return nil, fmt.Errorf("failed to register node: %w", err)
+		}
+	}
+
 	loadedQuestions, err := LoadQuizQuestionsFromFile()
 	if err != nil {
 		return nil, err
 	}
 
-	sessionManager := NewSessionManager(maxSessionCount, maxPlayersPerSession, ablyClient, loadedQuestions)
+	// Sessions save their results through the account ratings and leaderboards so every
+	// completed game updates ratings and announces a leaderboard change.
+	ratedResults := &ratingResultsStore{ResultsStore: config.ResultsStore, accounts: config.AccountStore}
+	leaderboardChannel := newSignedChannel(ablyClient.Channels.Get(LeaderboardChannelName), config.EventSigner, "")
+	leaderboards := NewLeaderboards(ratedResults, leaderboardChannel)
+	sessionManager := NewSessionManager(SessionManagerConfig{
+		MaxSessions:            config.MaxSessionCount,
+		MaxPlayersPerSession:   config.MaxPlayersPerSession,
+		AblyConnection:         ablyClient,
+		Questions:              loadedQuestions,
+		ResultsStore:           leaderboards,
+		EventSigner:            config.EventSigner,
+		HideStandingsQuestions: config.HideStandingsQuestions,
+		SnapshotStore:          config.SnapshotStore,
+		SnapshotInterval:       config.SnapshotInterval,
+		AnswerQueueSize:        config.AnswerQueueSize,
+		Registry:               config.Registry,
+		NodeID:                 config.Node.ID,
+		MaxSessionsPerClient:   config.RateLimits.MaxSessionsPerClient,
+		WaitingRoomTimeout:     config.WaitingRoomTimeout,
+		MaxSessionLifetime:     config.MaxSessionLifetime,
+	})
 
 	qs := &QuizServer{
-		ctx:            ctx,
-		commandChan:    commandChan,
-		SessionManager: sessionManager,
+		ctx:                  ctx,
+		commandChan:          commandChan,
+		SessionManager:       sessionManager,
+		MaxSessionCount:      config.MaxSessionCount,
+		MaxPlayersPerSession: config.MaxPlayersPerSession,
+		ResultsStore:         leaderboards,
+		Leaderboards:         leaderboards,
+		AccountStore:         config.AccountStore,
+		TokenIssuer:          config.TokenIssuer,
+		ablyClient:           ablyClient,
+		ablyTokenTTL:         config.AblyTokenTTL,
+		eventSigner:          config.EventSigner,
+		registry:             config.Registry,
+		nodeID:               config.Node.ID,
+		commandTimeout:       config.CommandTimeout,
+		rateLimits:           config.RateLimits,
+		clientLimiter:        newRateLimiter(config.RateLimits.ClientRate, config.RateLimits.ClientBurst),
+		answerLimiter:        newRateLimiter(config.RateLimits.AnswerRate, config.RateLimits.AnswerBurst),
+		grpcServiceKey:       []byte(config.GRPCServiceKey),
+	}
+	if qs.commandTimeout <= 0 {
+		qs.commandTimeout = DefaultCommandTimeout
+	}
+	if config.Registry != nil {
+		go qs.runHeartbeat(config.Node)
 	}
 
 	fmt.Println("Quiz server started.")
 	return qs, nil
 }
 
-// ConnectToSessionHandler handles the connection of a player to a session.
+// stopGracePeriod is how long Shutdown waits for stopped sessions to publish their end event.
+const stopGracePeriod = 5 * time.Second
+
+// Shutdown stops new players joining and waits for the sessions in progress to finish. Once ctx
+// is done the remaining sessions are stopped, telling their players the server is shutting
+// down. HTTP requests are still served meanwhile, so players can keep answering.
+func (qs *QuizServer) Shutdown(ctx context.Context) error {
+	qs.SessionManager.Drain()
+	select {
+	case <-qs.SessionManager.Drained():
+		return nil
+	case <-ctx.Done():
+	}
+
+	qs.SessionManager.StopSessions()
+	select {
+	case <-qs.SessionManager.Drained():
+		return nil
+	case <-time.After(stopGracePeriod):
+		return errors.New("timed out waiting for sessions to stop")
+	}
+}
+
+// Close closes the realtime connection, after Shutdown so the last events are published.
+func (qs *QuizServer) Close() {
+	qs.ablyClient.Close()
+}
+
+// commandContext carries the request's context, and its deadline bounded by the command
+// timeout, to the session commands of the request.
+func (qs *QuizServer) commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, qs.commandTimeout)
+}
+
+// join adds a player to a session, see ConnectToSessionHandler. The session is the first
+// waiting one if sessionId is empty. Sessions the player creates count toward the limit of
+// client, unless it is empty.
+func (qs *QuizServer) join(ctx context.Context, sessionId, client string, request protocol.JoinSessionRequest) (protocol.JoinSessionResponse, error) {
+	player := Player{
+		Name: request.PlayerName,
+		ID:   generateUniqueID(),
+	}
+	if request.AccountId != "" {
+		account, err := qs.AccountStore.Authenticate(request.AccountId, request.AccountKey)
+		if err != nil {
+			return protocol.JoinSessionResponse{}, err
+		}
+		player = Player{Name: account.Name, ID: account.ID}
+	}
+
+	ctx, cancel := qs.commandContext(ctx)
+	defer cancel()
+	response, err := qs.SessionManager.Send(ctx, SessionManagerCommand{
+		CommandType: JoinSession,
+		player:      player,
+		SessionId:   sessionId,
+		client:      client,
+	})
+	if err == nil {
+		err = response.Error
+	}
+	if err != nil {
+		return protocol.JoinSessionResponse{}, err
+	}
+
+	token, expiresAt, err := qs.TokenIssuer.Issue(player.ID, response.SessionId)
+	if err != nil {
+		return protocol.JoinSessionResponse{}, fmt.Errorf("failed to issue player token: %w", err)
+	}
+	return protocol.JoinSessionResponse{
+		SessionId:      response.SessionId,
+		PlayerId:       player.ID,
+		PlayerName:     response.PlayerName,
+		Token:          token,
+		TokenExpiresAt: expiresAt,
+		EventPublicKey: qs.eventSigner.PublicKey(),
+	}, nil
+}
+
+// spectate lets someone watch a session, see SpectateSessionHandler.
+func (qs *QuizServer) spectate(ctx context.Context, sessionId string) (protocol.JoinSessionResponse, error) {
+	spectatorId := generateUniqueID()
+	ctx, cancel := qs.commandContext(ctx)
+	defer cancel()
+	response, err := qs.SessionManager.Send(ctx, SessionManagerCommand{
+		CommandType: SpectateSession,
+		player:      Player{ID: spectatorId},
+		SessionId:   sessionId,
+	})
+	if err == nil {
+		err = response.Error
+	}
+	if err != nil {
+		return protocol.JoinSessionResponse{}, err
+	}
+
+	token, expiresAt, err := qs.TokenIssuer.IssueSpectator(spectatorId, response.SessionId)
+	if err != nil {
+		return protocol.JoinSessionResponse{}, fmt.Errorf("failed to issue spectator token: %w", err)
+	}
+	return protocol.JoinSessionResponse{
+		SessionId:      response.SessionId,
+		PlayerId:       spectatorId,
+		Token:          token,
+		TokenExpiresAt: expiresAt,
+		EventPublicKey: qs.eventSigner.PublicKey(),
+		Spectator:      true,
+	}, nil
+}
+
+// submitAnswer hands the answer of the player of claims to the session of the request.
+func (qs *QuizServer) submitAnswer(ctx context.Context, claims PlayerClaims, request protocol.SubmitAnswerRequest) error {
+	if request.SessionId != claims.SessionID {
+		return ErrWrongSession
+	}
+	if claims.Spectator {
+		return ErrSpectatorAnswer
+	}
+	if retryAfter, ok := qs.answerLimiter.allow(claims.PlayerID); !ok {
+		return &RateLimitError{RetryAfter: retryAfter}
+	}
+
+	ctx, cancel := qs.commandContext(ctx)
+	defer cancel()
+	return qs.SessionManager.SubmitAnswer(ctx, request.SessionId, Player{ID: claims.PlayerID}, Answer{
+		AnswerChoice:    request.Answer,
+		CurrentQuestion: request.QuestionIndex,
+		QuestionID:      request.QuestionId,
+	})
+}
+
+// ConnectToSessionHandler handles the connection of a player to a session: the session of the
+// path while it waits for players, or the first waiting session when the path has none or
+// protocol.AnySession. Anonymous players are given a new player ID, players with an account
+// join with the account's ID and name. Either way the response carries the token the player
+// must present on later requests, and the public key used to verify the events published on
+// the session channel.
 func (qs *QuizServer) ConnectToSessionHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Processing request to connect to a session.")
 
-	var request struct {
-		PlayerName string `json:"playerName"`
-		PlayerId   string `json:"playerId"`
+	sessionId := pathParam(r, "sessionId")
+	if sessionId == protocol.AnySession {
+		sessionId = ""
+	}
+	if sessionId != "" && qs.forwardToOwner(w, r, sessionId) {
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Failed to parse request body.", http.StatusBadRequest)
+	var request protocol.JoinSessionRequest
+	if !decodeRequest(w, r, &request) {
 		return
 	}
 
-	if request.PlayerName == "" || request.PlayerId == "" {
-		http.Error(w, "Player name and ID are required.", http.StatusBadRequest)
+	response, err := qs.join(r.Context(), sessionId, qs.clientIP(r), request)
+	if err != nil {
+		writeErrorFor(w, err)
 		return
 	}
 
-	responseChan := make(chan SessionManagerResponse)
-	qs.SessionManager.CommandChan <- SessionManagerCommand{
-		CommandType: JoinSession,
-		player: Player{
-			Name: request.PlayerName,
-			ID:   request.PlayerId,
-		},
-		ResponseChan: responseChan,
+	writeJSON(w, response)
+}
+
+// SpectateSessionHandler lets someone watch a waiting or in progress session without taking a
+// player slot. The session is in the path, or in the body on the unversioned SpectatePath.
+// The spectator token only allows fetching realtime tokens.
+func (qs *QuizServer) SpectateSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionId := pathParam(r, "sessionId")
+	if sessionId == "" {
+		// The body is kept, the request is forwarded as is when the session runs on another node.
+		body, err := io.ReadAll(r.Body)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeErrorFor(w, ErrRequestTooLarge)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, protocol.ErrorCodeInvalidRequest, "Failed to read request body.")
+			return
+		}
+		var request protocol.SpectateSessionRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeError(w, http.StatusBadRequest, protocol.ErrorCodeInvalidRequest, "Failed to parse request body.")
+			return
+		}
+		sessionId = request.SessionId
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if sessionId == "" {
+		writeError(w, http.StatusBadRequest, protocol.ErrorCodeInvalidRequest, "Session ID is required.")
+		return
+	}
+	if qs.forwardToOwner(w, r, sessionId) {
+		return
+	}
+
+	response, err := qs.spectate(r.Context(), sessionId)
+	if err != nil {
+		writeErrorFor(w, err)
+		return
 	}
 
-	response := <-responseChan
-	if response.Error != nil {
-		http.Error(w, response.Error.Error(), http.StatusInternalServerError)
+	writeJSON(w, response)
+}
+
+// SubmitAnswerHandler processes the submission of a quiz answer, for the session of the path or,
+// on the unversioned SubmitAnswerPath, of the body.
+func (qs *QuizServer) SubmitAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	var request protocol.SubmitAnswerRequest
+
+	claims, err := qs.TokenIssuer.VerifyRequest(r)
+	if err != nil {
+		writeErrorFor(w, err)
+		return
+	}
+	// Tokens are valid on every node, the answer goes to the node running the session.
+	if qs.forwardToOwner(w, r, claims.SessionID) {
 		return
 	}
 
-	var responseJSON struct {
-		SessionId string `json:"sessionId"`
+	if !decodeRequest(w, r, &request) {
+		return
 	}
 
-	responseJSON.SessionId = response.SessionId
-	responseJSONBytes, err := json.Marshal(responseJSON)
+	if sessionId := pathParam(r, "sessionId"); sessionId != "" {
+		if request.SessionId != "" && request.SessionId != sessionId {
+			writeError(w, http.StatusBadRequest, protocol.ErrorCodeInvalidRequest, "Session ID of the body does not match the path.")
+			return
+		}
+		request.SessionId = sessionId
+	}
+	if request.SessionId == "" {
+		writeError(w, http.StatusBadRequest, protocol.ErrorCodeInvalidRequest, "Session ID is required.")
+		return
+	}
+
+	if err := qs.submitAnswer(r.Context(), claims, request); err != nil {
+		writeErrorFor(w, err)
+		return
+	}
+
+	writeJSON(w, protocol.SubmitAnswerResponse{Message: "Answer submitted successfully."})
+}
+
+// SessionResultHandler returns the recorded result of a completed session.
+func (qs *QuizServer) SessionResultHandler(w http.ResponseWriter, r *http.Request) {
+	result, err := qs.ResultsStore.GetSessionResult(pathParam(r, "sessionId"))
 	if err != nil {
-		http.Error(w, "Failed to marshal response.", http.StatusInternalServerError)
+		writeErrorFor(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(responseJSONBytes); err != nil {
-		fmt.Printf("Error writing response: %s\n", err)
+	writeJSON(w, result)
+}
+
+// PlayerHistoryHandler returns every recorded session a player took part in.
+func (qs *QuizServer) PlayerHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	history, err := qs.ResultsStore.GetPlayerHistory(pathParam(r, "playerId"))
+	if err != nil {
+		writeErrorFor(w, err)
+		return
 	}
+
+	writeJSON(w, history)
 }
 
-// SubmitAnswerHandler processes the submission of a quiz answer.
-func (qs *QuizServer) SubmitAnswerHandler(w http.ResponseWriter, r *http.Request) {
-	var request struct {
-		SessionId string `json:"sessionId"`
-		PlayerId  string `json:"playerId"`
-		Answer    int    `json:"answer"`
+// LeaderboardHandler returns a page of a leaderboard, e.g. ?period=weekly&page=1&pageSize=10.
+// The period defaults to all-time, the page to 1 and the page size to 10.
+func (qs *QuizServer) LeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	period := AllTimeLeaderboard
+	if query.Get("period") != "" {
+		period = LeaderboardPeriod(query.Get("period"))
+	}
+	page, pageSize := 1, 10
+	var err error
+	if query.Get("page") != "" {
+		if page, err = strconv.Atoi(query.Get("page")); err != nil {
+			writeError(w, http.StatusBadRequest, protocol.ErrorCodeInvalidRequest, "Page must be a number.")
+			return
+		}
+	}
+	if query.Get("pageSize") != "" {
+		if pageSize, err = strconv.Atoi(query.Get("pageSize")); err != nil || pageSize > 100 {
+			writeError(w, http.StatusBadRequest, protocol.ErrorCodeInvalidRequest, "Page size must be a number no greater than 100.")
+			return
+		}
 	}
-	var responseJSON struct {
-		Message string `json:"message"`
+
+	leaderboard, err := qs.Leaderboards.GetLeaderboard(period, page, pageSize)
+	if err != nil {
+		// The leaderboards only fail on an unknown period or an invalid page.
+		writeError(w, http.StatusBadRequest, protocol.ErrorCodeInvalidRequest, err.Error())
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Failed to parse request body.", http.StatusBadRequest)
+	writeJSON(w, leaderboard)
+}
+
+// CreateAccountHandler creates a persistent player account.
+// The account key is only returned here, it is needed to join sessions as the account.
+func (qs *QuizServer) CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var request protocol.CreateAccountRequest
+	if !decodeRequest(w, r, &request) {
 		return
 	}
 
-	if request.PlayerId == "" || request.SessionId == "" {
-		http.Error(w, "Session ID and player ID are required.", http.StatusBadRequest)
+	account, key, err := qs.AccountStore.CreateAccount(request.Name)
+	if err != nil {
+		writeErrorFor(w, err)
 		return
 	}
 
-	responseChan := make(chan SessionManagerResponse)
-	qs.SessionManager.CommandChan <- SessionManagerCommand{
-		CommandType: SubmitAnswer,
-		player: Player{
-			ID: request.PlayerId,
-		},
-		SessionId:    request.SessionId,
-		answer:       request.Answer,
-		ResponseChan: responseChan,
+	writeJSON(w, protocol.CreateAccountResponse{
+		AccountResponse: account.response(),
+		AccountKey:      key,
+	})
+}
+
+// AccountHandler returns the public profile of an account.
+func (qs *QuizServer) AccountHandler(w http.ResponseWriter, r *http.Request) {
+	account, err := qs.AccountStore.GetAccount(pathParam(r, "accountId"))
+	if err != nil {
+		writeErrorFor(w, err)
+		return
 	}
 
-	response := <-responseChan
-	if response.Error != nil {
-		http.Error(w, response.Error.Error(), http.StatusInternalServerError)
+	writeJSON(w, account.response())
+}
+
+// AblyTokenHandler mints a realtime token request for a player. The token only
+// allows subscribing to the channel of the session the player token was issued for, so players
+// never hold a key that could publish to a session.
+func (qs *QuizServer) AblyTokenHandler(w http.ResponseWriter, r *http.Request) {
+	claims, err := qs.TokenIssuer.VerifyRequest(r)
+	if err != nil {
+		writeErrorFor(w, err)
 		return
 	}
 
-	responseJSON.Message = "Answer submitted successfully."
-	bytes, err := json.Marshal(responseJSON)
+	capability, err := json.Marshal(map[string][]string{claims.SessionID: {"subscribe"}})
 	if err != nil {
-		http.Error(w, "Failed to marshal response.", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, protocol.ErrorCodeInternal, "Failed to build token capability.")
 		return
 	}
 
+	tokenRequest, err := qs.ablyClient.Auth.CreateTokenRequest(&ably.TokenParams{
+		TTL:        qs.ablyTokenTTL.Milliseconds(),
+		Capability: string(capability),
+		ClientID:   claims.PlayerID,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, protocol.ErrorCodeInternal, "Failed to create realtime token.")
+		return
+	}
+
+	writeJSON(w, tokenRequest)
+}
+
+// EventSchemaHandler serves the JSON Schema of the realtime events.
+func (qs *QuizServer) EventSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	if _, err := w.Write(events.Schema); err != nil {
+		fmt.Printf("Error writing response: %s\n", err)
+	}
+}
+
+// OpenAPIHandler serves the OpenAPI document of the versioned API.
+func (qs *QuizServer) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(bytes); err != nil {
+	if _, err := w.Write(protocol.OpenAPI); err != nil {
 		fmt.Printf("Error writing response: %s\n", err)
 	}
 }
+
+// Handler routes the HTTP API: the versioned API under protocol.APIPrefix, described by
+// protocol.OpenAPI, and the unversioned paths of older clients.
+func (qs *QuizServer) Handler() http.Handler {
+	return qs.limitBodies(qs.newRouter())
+}
+
+func (qs *QuizServer) newRouter() *router {
+	rt := &router{}
+	sessionPath := func(resource string) string {
+		return protocol.APIPrefix + "/sessions/{sessionId}/" + resource
+	}
+	rt.handle(http.MethodPost, sessionPath(protocol.SessionPlayers), qs.limitClient(qs.ConnectToSessionHandler))
+	rt.handle(http.MethodPost, sessionPath(protocol.SessionSpectators), qs.limitClient(qs.SpectateSessionHandler))
+	rt.handle(http.MethodPost, sessionPath(protocol.SessionAnswers), qs.limitClient(qs.SubmitAnswerHandler))
+	rt.handle(http.MethodGet, sessionPath(protocol.SessionResult), qs.SessionResultHandler)
+	rt.handle(http.MethodGet, protocol.APIPrefix+"/players/{playerId}/history", qs.PlayerHistoryHandler)
+	rt.handle(http.MethodGet, protocol.LeaderboardV1Path, qs.LeaderboardHandler)
+	rt.handle(http.MethodPost, protocol.AccountsV1Path, qs.CreateAccountHandler)
+	rt.handle(http.MethodGet, protocol.AccountsV1Path+"/{accountId}", qs.AccountHandler)
+	rt.handle(http.MethodPost, protocol.TokenV1Path, qs.AblyTokenHandler)
+	rt.handle(http.MethodGet, protocol.EventSchemaV1Path, qs.EventSchemaHandler)
+	rt.handle(http.MethodGet, protocol.OpenAPIPath, qs.OpenAPIHandler)
+
+	// The unversioned API.
+	rt.handle(http.MethodPost, protocol.ConnectToSessionPath, qs.limitClient(qs.ConnectToSessionHandler))
+	rt.handle(http.MethodPost, protocol.SpectatePath, qs.limitClient(qs.SpectateSessionHandler))
+	rt.handle(http.MethodPost, protocol.SubmitAnswerPath, qs.limitClient(qs.SubmitAnswerHandler))
+	rt.handle(http.MethodGet, "/results/{sessionId}", qs.SessionResultHandler)
+	rt.handle(http.MethodGet, "/players/{playerId}/history", qs.PlayerHistoryHandler)
+	rt.handle(http.MethodGet, "/leaderboard", qs.LeaderboardHandler)
+	rt.handle(http.MethodPost, protocol.AccountsPath, qs.CreateAccountHandler)
+	rt.handle(http.MethodGet, protocol.AccountsPath+"/{accountId}", qs.AccountHandler)
+	rt.handle(http.MethodPost, protocol.TokenPath, qs.AblyTokenHandler)
+	rt.handle(http.MethodGet, protocol.EventSchemaPath, qs.EventSchemaHandler)
+	return rt
+}
@@ -0,0 +1,186 @@
+package quiz_server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRateLimited = errors.New("too many requests")
+	// ErrClientSessionLimit is returned when a client would create more sessions than it may
+	// have running at once.
+	ErrClientSessionLimit = errors.New("too many sessions created by this client are still running")
+	ErrRequestTooLarge    = errors.New("request body is too large")
+)
+
+// RateLimitError is returned for requests over a rate limit, RetryAfter is how long until the
+// next request would be allowed. It matches ErrRateLimited.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrRateLimited, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// retryAfterSeconds is the Retry-After header of the error, rounded up to whole seconds.
+func (e *RateLimitError) retryAfterSeconds() string {
+	return fmt.Sprint(int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// RateLimits protect the server from clients flooding it, a zero rate or limit disables it.
+type RateLimits struct {
+	// ClientRate and ClientBurst limit the joins, spectates and answers of each client IP, in
+	// requests per second and requests at once.
+	ClientRate  float64
+	ClientBurst int
+	// AnswerRate and AnswerBurst limit the answers of each player, on both APIs.
+	AnswerRate  float64
+	AnswerBurst int
+	// MaxSessionsPerClient caps the sessions a client IP created that are still running, so a
+	// script cannot take every session slot of the server.
+	MaxSessionsPerClient int
+	// MaxBodyBytes caps the size of request bodies.
+	MaxBodyBytes int64
+	// TrustForwardedFor identifies clients by the address the proxy in front of the server adds
+	// to X-Forwarded-For, rather than by the address of the connection.
+	TrustForwardedFor bool
+}
+
+// DefaultRateLimits are generous enough for any player, but stop scripts flooding the server.
+var DefaultRateLimits = RateLimits{
+	ClientRate:           10,
+	ClientBurst:          20,
+	AnswerRate:           2,
+	AnswerBurst:          4,
+	MaxSessionsPerClient: 2,
+	MaxBodyBytes:         64 << 10,
+}
+
+// rateLimiterSweepInterval is how often buckets that refilled are forgotten.
+const rateLimiterSweepInterval = time.Minute
+
+// tokenBucket holds the tokens of a key, as of updated.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter keeps a token bucket for each key, refilled at rate tokens per second up to burst.
+// A nil rateLimiter allows everything.
+type rateLimiter struct {
+	rate      float64
+	burst     float64
+	now       func() time.Time
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// newRateLimiter returns a limiter, or nil if rate is not positive.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the bucket of key. If it is empty it returns false and how long
+// until a token is available.
+func (l *rateLimiter) allow(key string) (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second)), false
+}
+
+// sweep forgets the buckets that have refilled since they were last used, they would be
+// recreated full. The caller must hold the lock.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	refillTime := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= refillTime {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientIP identifies the client of a request by its IP address.
+func (qs *QuizServer) clientIP(r *http.Request) string {
+	if qs.rateLimits.TrustForwardedFor {
+		// The last address was added by the proxy in front of the server, the others could
+		// have been sent by the client.
+		if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+			addresses := strings.Split(forwardedFor[len(forwardedFor)-1], ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limitClient rejects the requests of clients over their rate with 429. Requests forwarded by
+// another node were limited by that node, see isForwarded.
+func (qs *QuizServer) limitClient(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, forwarded := qs.isForwarded(r); !forwarded {
+			if retryAfter, ok := qs.clientLimiter.allow(qs.clientIP(r)); !ok {
+				writeErrorFor(w, &RateLimitError{RetryAfter: retryAfter})
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// limitBodies caps the size of request bodies, see decodeRequest.
+func (qs *QuizServer) limitBodies(handler http.Handler) http.Handler {
+	if qs.rateLimits.MaxBodyBytes <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, qs.rateLimits.MaxBodyBytes)
+		handler.ServeHTTP(w, r)
+	})
+}
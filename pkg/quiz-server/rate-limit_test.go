@@ -0,0 +1,116 @@
+package quiz_server
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"the-quiz-game/pkg/protocol"
+	"time"
+)
+
+// Buckets must allow bursts, then refill at their rate, and be forgotten once full again.
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		_, ok := limiter.allow("client1")
+		require.True(t, ok)
+	}
+	retryAfter, ok := limiter.allow("client1")
+	require.False(t, ok)
+	require.Equal(t, time.Second, retryAfter)
+	_, ok = limiter.allow("client2")
+	require.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	retryAfter, ok = limiter.allow("client1")
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, retryAfter)
+	now = now.Add(500 * time.Millisecond)
+	_, ok = limiter.allow("client1")
+	require.True(t, ok)
+
+	now = now.Add(rateLimiterSweepInterval)
+	_, ok = limiter.allow("client3")
+	require.True(t, ok)
+	require.Len(t, limiter.buckets, 1)
+
+	var unlimited *rateLimiter
+	_, ok = unlimited.allow("client1")
+	require.True(t, ok)
+}
+
+func serveJoin(qs *QuizServer, remoteAddr, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, protocol.SessionPath(protocol.AnySession, protocol.SessionPlayers), strings.NewReader(body))
+	request.RemoteAddr = remoteAddr
+	recorder := httptest.NewRecorder()
+	qs.Handler().ServeHTTP(recorder, request)
+	return recorder
+}
+
+func requireErrorCode(t *testing.T, recorder *httptest.ResponseRecorder, status int, code string) {
+	require.Equal(t, status, recorder.Code)
+	var response protocol.ErrorResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, code, response.Code)
+}
+
+// Clients over their rate must be refused with 429 and Retry-After, and large bodies with 413.
+func TestQuizServer_RateLimits(t *testing.T) {
+	qs := newTestQuizServer(t)
+	qs.rateLimits = RateLimits{MaxBodyBytes: 64}
+	qs.clientLimiter = newRateLimiter(0.5, 1)
+
+	require.Equal(t, http.StatusOK, serveJoin(qs, "10.0.0.1:1234", `{"playerName": "Alice"}`).Code)
+	recorder := serveJoin(qs, "10.0.0.1:5678", `{"playerName": "Alice"}`)
+	requireErrorCode(t, recorder, http.StatusTooManyRequests, protocol.ErrorCodeRateLimited)
+	require.Equal(t, "2", recorder.Header().Get("Retry-After"))
+
+	recorder = serveJoin(qs, "10.0.0.2:1234", `{"playerName": "`+strings.Repeat("A", 64)+`"}`)
+	requireErrorCode(t, recorder, http.StatusRequestEntityTooLarge, protocol.ErrorCodeRequestTooLarge)
+}
+
+// A client must not hold more running sessions than allowed, ending one frees its place.
+func TestSessionManager_MaxSessionsPerClient(t *testing.T) {
+	manager := NewSessionManager(SessionManagerConfig{MaxSessions: 3, MaxSessionsPerClient: 1, AblyConnection: newTestAblyConnection(t)})
+
+	sessionId, err := manager.createSession("10.0.0.1")
+	require.NoError(t, err)
+	_, err = manager.createSession("10.0.0.1")
+	require.ErrorIs(t, err, ErrClientSessionLimit)
+	_, err = manager.createSession("10.0.0.2")
+	require.NoError(t, err)
+
+	manager.handleCommand(SessionManagerCommand{CommandType: EndSession, SessionId: sessionId})
+	_, err = manager.createSession("10.0.0.1")
+	require.NoError(t, err)
+}
+
+// Only requests forwarded by a node of the cluster skip the client limit, a header set by the
+// client itself must be ignored.
+func TestQuizServer_SpoofedForwardedByIsLimited(t *testing.T) {
+	qs := newTestQuizServer(t)
+	qs.nodeID = "node1"
+	qs.clientLimiter = newRateLimiter(0.5, 1)
+	serveForwarded := func(forwardedBy func(r *http.Request) string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, protocol.SessionPath(protocol.AnySession, protocol.SessionPlayers), strings.NewReader(`{"playerName": "Alice"}`))
+		request.RemoteAddr = "10.0.0.1:1234"
+		request.Header.Set(forwardedByHeader, forwardedBy(request))
+		recorder := httptest.NewRecorder()
+		qs.Handler().ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	forged := func(value string) func(r *http.Request) string {
+		return func(r *http.Request) string { return value }
+	}
+	require.Equal(t, http.StatusOK, serveForwarded(forged("node2")).Code)
+	requireErrorCode(t, serveForwarded(forged("node2")), http.StatusTooManyRequests, protocol.ErrorCodeRateLimited)
+	requireErrorCode(t, serveForwarded(forged("node=node2&signature=forged")), http.StatusTooManyRequests, protocol.ErrorCodeRateLimited)
+	require.Equal(t, http.StatusOK, serveForwarded(func(r *http.Request) string { return qs.forwardedBy(r, "") }).Code)
+}
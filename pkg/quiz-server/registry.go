@@ -0,0 +1,338 @@
+package quiz_server
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNodeNotFound      = errors.New("node not found")
+	ErrSessionNotClaimed = errors.New("session is not owned by any node")
+	// ErrSessionOnOtherNode is returned by the gRPC API for sessions of another node, the HTTP API
+	// forwards their requests instead.
+	ErrSessionOnOtherNode = errors.New("session runs on another node")
+)
+
+// Node is a quiz server instance, reachable by the other nodes at its URL.
+type Node struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// NodeHeartbeatInterval is how often nodes register again, and NodeTTL how long a FileRegistry
+// keeps a node that stopped doing so. The sessions of a node that is gone are released, rather
+// than their requests being forwarded to it.
+const (
+	NodeHeartbeatInterval = 10 * time.Second
+	NodeTTL               = 3 * NodeHeartbeatInterval
+)
+
+// SessionRegistry records which node owns each session, so several quiz servers can share the
+// load and route the requests of a session to the node running it. A session is owned by the
+// node that created it until it ends, or until the node is gone.
+type SessionRegistry interface {
+	// RegisterNode adds a node or, every NodeHeartbeatInterval, tells the registry it still runs.
+	RegisterNode(node Node) error
+	ClaimSession(sessionId, nodeId string) error
+	ReleaseSession(sessionId string) error
+	// LookupSession returns the node owning a session.
+	LookupSession(sessionId string) (Node, error)
+}
+
+// MemoryRegistry is a SessionRegistry for nodes running in the same process, such as in tests.
+type MemoryRegistry struct {
+	mutex    sync.RWMutex
+	nodes    map[string]Node
+	sessions map[string]string
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		nodes:    make(map[string]Node),
+		sessions: make(map[string]string),
+	}
+}
+
+func (m *MemoryRegistry) RegisterNode(node Node) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.nodes[node.ID] = node
+	return nil
+}
+
+func (m *MemoryRegistry) ClaimSession(sessionId, nodeId string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sessions[sessionId] = nodeId
+	return nil
+}
+
+func (m *MemoryRegistry) ReleaseSession(sessionId string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.sessions, sessionId)
+	return nil
+}
+
+func (m *MemoryRegistry) LookupSession(sessionId string) (Node, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	nodeId, ok := m.sessions[sessionId]
+	if !ok {
+		return Node{}, ErrSessionNotClaimed
+	}
+	node, ok := m.nodes[nodeId]
+	if !ok {
+		return Node{}, ErrNodeNotFound
+	}
+	return node, nil
+}
+
+// FileRegistry is a SessionRegistry kept in a directory shared by every node, e.g. on a network
+// volume. Nodes and session claims are one small file each, written atomically, so nodes never
+// overwrite each other's changes. Nodes that did not register for NodeTTL are gone, every claim
+// they hold is released the first time one of them is looked up.
+type FileRegistry struct {
+	dir     string
+	nodeTTL time.Duration
+	now     func() time.Time
+}
+
+// nodeRecord is the file of a node, with when it last registered.
+type nodeRecord struct {
+	Node
+	RegisteredAt time.Time `json:"registeredAt"`
+}
+
+func NewFileRegistry(dir string) (*FileRegistry, error) {
+	for _, subDir := range []string{"nodes", "sessions"} {
+		if err := os.MkdirAll(filepath.Join(dir, subDir), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create registry directory: %w", err)
+		}
+	}
+	return &FileRegistry{dir: dir, nodeTTL: NodeTTL, now: time.Now}, nil
+}
+
+func (f *FileRegistry) path(kind, id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("invalid ID %q", id)
+	}
+	return filepath.Join(f.dir, kind, id+".json"), nil
+}
+
+func (f *FileRegistry) write(kind, id string, v interface{}) error {
+	path, err := f.path(kind, id)
+	if err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, jsonData, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (f *FileRegistry) read(kind, id string, v interface{}, notFound error) error {
+	path, err := f.path(kind, id)
+	if err != nil {
+		return err
+	}
+	fileContent, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return notFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(fileContent, v)
+}
+
+func (f *FileRegistry) RegisterNode(node Node) error {
+	return f.write("nodes", node.ID, nodeRecord{Node: node, RegisteredAt: f.now()})
+}
+
+func (f *FileRegistry) ClaimSession(sessionId, nodeId string) error {
+	return f.write("sessions", sessionId, nodeId)
+}
+
+func (f *FileRegistry) ReleaseSession(sessionId string) error {
+	path, err := f.path("sessions", sessionId)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (f *FileRegistry) LookupSession(sessionId string) (Node, error) {
+	var nodeId string
+	if err := f.read("sessions", sessionId, &nodeId, ErrSessionNotClaimed); err != nil {
+		return Node{}, err
+	}
+	var record nodeRecord
+	if err := f.read("nodes", nodeId, &record, ErrNodeNotFound); err != nil {
+		return Node{}, err
+	}
+	if f.now().Sub(record.RegisteredAt) > f.nodeTTL {
+		// The node stopped without releasing its sessions, they ended with it.
+		if err := f.releaseClaimsOf(nodeId); err != nil {
+			return Node{}, err
+		}
+		return Node{}, ErrSessionNotClaimed
+	}
+	return record.Node, nil
+}
+
+// releaseClaimsOf releases every session claimed by a node.
+func (f *FileRegistry) releaseClaimsOf(nodeId string) error {
+	files, err := filepath.Glob(filepath.Join(f.dir, "sessions", "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		sessionId := strings.TrimSuffix(filepath.Base(file), ".json")
+		var owner string
+		err := f.read("sessions", sessionId, &owner, ErrSessionNotClaimed)
+		if errors.Is(err, ErrSessionNotClaimed) {
+			// Released by another node since the directory was listed.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if owner != nodeId {
+			continue
+		}
+		if err := f.ReleaseSession(sessionId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runHeartbeat registers this node again every NodeHeartbeatInterval until the server stops,
+// so the other nodes know it still runs its sessions.
+func (qs *QuizServer) runHeartbeat(node Node) {
+	ticker := time.NewTicker(NodeHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-qs.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := qs.registry.RegisterNode(node); err != nil {
+				fmt.Printf("Error renewing the registration of node %s: %v\n", node.ID, err)
+			}
+		}
+	}
+}
+
+// otherOwner returns the node owning a session, if it is another node of the cluster.
+func (qs *QuizServer) otherOwner(sessionId string) (Node, bool) {
+	if qs.registry == nil {
+		return Node{}, false
+	}
+	node, err := qs.registry.LookupSession(sessionId)
+	if errors.Is(err, ErrSessionNotClaimed) {
+		return Node{}, false
+	}
+	if err != nil {
+		fmt.Printf("Error looking up the owner of session %s: %v\n", sessionId, err)
+		return Node{}, false
+	}
+	return node, node.ID != qs.nodeID
+}
+
+// forwardedByHeader marks requests forwarded by another node, they are never forwarded again.
+// Its value is URL encoded: the ID of the node, when it forwarded the request, the session the
+// request is for and an HMAC of all of them and of the method and path of the request, with the
+// token secret the nodes share. Clients can neither set it to skip forwarding or their rate
+// limit, nor replay a value seen on another request or after forwardedByMaxAge.
+const forwardedByHeader = "X-Quiz-Forwarded-By"
+
+// forwardedByMaxAge is how long a forwardedByHeader value is accepted, either way to allow for
+// clock differences between nodes.
+const forwardedByMaxAge = 10 * time.Second
+
+func (qs *QuizServer) signForwarded(r *http.Request, nodeId, sessionId, forwardedAt string) string {
+	return qs.TokenIssuer.sign(strings.Join([]string{forwardedByHeader, nodeId, forwardedAt, r.Method, r.URL.Path, sessionId}, "\n"))
+}
+
+// forwardedBy returns the value of forwardedByHeader for a request for a session forwarded by
+// this node.
+func (qs *QuizServer) forwardedBy(r *http.Request, sessionId string) string {
+	forwardedAt := strconv.FormatInt(qs.TokenIssuer.now().Unix(), 10)
+	return url.Values{
+		"node":      {qs.nodeID},
+		"at":        {forwardedAt},
+		"session":   {sessionId},
+		"signature": {qs.signForwarded(r, qs.nodeID, sessionId, forwardedAt)},
+	}.Encode()
+}
+
+// isForwarded reports whether a request was forwarded by a node of the cluster, and for which
+// session. A header that was not signed with the shared secret for this request, or that is too
+// old, is removed, the request is then handled as any other.
+func (qs *QuizServer) isForwarded(r *http.Request) (string, bool) {
+	value := r.Header.Get(forwardedByHeader)
+	if value == "" {
+		return "", false
+	}
+	if values, err := url.ParseQuery(value); err == nil && qs.TokenIssuer != nil {
+		nodeId, forwardedAt, sessionId := values.Get("node"), values.Get("at"), values.Get("session")
+		seconds, err := strconv.ParseInt(forwardedAt, 10, 64)
+		age := qs.TokenIssuer.now().Sub(time.Unix(seconds, 0))
+		if err == nil && nodeId != "" && age <= forwardedByMaxAge && age >= -forwardedByMaxAge &&
+			hmac.Equal([]byte(values.Get("signature")), []byte(qs.signForwarded(r, nodeId, sessionId, forwardedAt))) {
+			return sessionId, true
+		}
+	}
+	r.Header.Del(forwardedByHeader)
+	return "", false
+}
+
+// forwardToOwner proxies a request for a session owned by another node to that node. It reports
+// whether the request was forwarded, in which case the owner's response has been written.
+// Requests for sessions of this node, or of no node, are handled here.
+func (qs *QuizServer) forwardToOwner(w http.ResponseWriter, r *http.Request, sessionId string) bool {
+	if forwardedSession, ok := qs.isForwarded(r); ok && forwardedSession == sessionId {
+		return false
+	}
+	node, ok := qs.otherOwner(sessionId)
+	if !ok {
+		return false
+	}
+	target, err := url.Parse(node.URL)
+	if err != nil {
+		fmt.Printf("Invalid URL of node %s: %v\n", node.ID, err)
+		return false
+	}
+
+	fmt.Printf("Forwarding request for session %s to node %s\n", sessionId, node.ID)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(forwarded *http.Request) {
+		director(forwarded)
+		// Signed last, for the path the owner receives.
+		forwarded.Header.Set(forwardedByHeader, qs.forwardedBy(forwarded, sessionId))
+	}
+	proxy.ServeHTTP(w, r)
+	return true
+}
@@ -0,0 +1,143 @@
+package quiz_server
+
+import (
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"the-quiz-game/pkg/protocol"
+	"time"
+)
+
+func TestFileRegistry_LookupSession(t *testing.T) {
+	dir := t.TempDir()
+	registry, err := NewFileRegistry(dir)
+	require.NoError(t, err)
+	node := Node{ID: "node1", URL: "http://node1:8080"}
+	require.NoError(t, registry.RegisterNode(node))
+
+	_, err = registry.LookupSession("session1")
+	require.ErrorIs(t, err, ErrSessionNotClaimed)
+
+	require.NoError(t, registry.ClaimSession("session1", "node1"))
+	// Claims are visible to every node sharing the directory.
+	other, err := NewFileRegistry(dir)
+	require.NoError(t, err)
+	owner, err := other.LookupSession("session1")
+	require.NoError(t, err)
+	require.Equal(t, node, owner)
+
+	require.NoError(t, registry.ClaimSession("session2", "node2"))
+	_, err = registry.LookupSession("session2")
+	require.ErrorIs(t, err, ErrNodeNotFound)
+
+	require.NoError(t, registry.ReleaseSession("session1"))
+	_, err = other.LookupSession("session1")
+	require.ErrorIs(t, err, ErrSessionNotClaimed)
+}
+
+// The sessions of a node that stopped registering must be released, rather than their requests
+// forwarded to a node that is gone.
+func TestFileRegistry_ExpiredNodeReleasesSessions(t *testing.T) {
+	dir := t.TempDir()
+	registry, err := NewFileRegistry(dir)
+	require.NoError(t, err)
+	now := time.Now()
+	registry.now = func() time.Time { return now }
+	node := Node{ID: "node1", URL: "http://node1:8080"}
+	require.NoError(t, registry.RegisterNode(node))
+	require.NoError(t, registry.ClaimSession("session1", "node1"))
+	require.NoError(t, registry.ClaimSession("session2", "node1"))
+	require.NoError(t, registry.ClaimSession("session3", "node2"))
+
+	// Each heartbeat keeps the node for another NodeTTL.
+	now = now.Add(NodeTTL)
+	require.NoError(t, registry.RegisterNode(node))
+	now = now.Add(NodeTTL)
+	owner, err := registry.LookupSession("session1")
+	require.NoError(t, err)
+	require.Equal(t, node, owner)
+
+	now = now.Add(time.Second)
+	_, err = registry.LookupSession("session1")
+	require.ErrorIs(t, err, ErrSessionNotClaimed)
+	for _, sessionId := range []string{"session1", "session2"} {
+		require.NoFileExists(t, filepath.Join(dir, "sessions", sessionId+".json"))
+	}
+	// Claims of other nodes are kept.
+	require.FileExists(t, filepath.Join(dir, "sessions", "session3.json"))
+}
+
+// Answers for a session of another node must be forwarded to it, with the player's token.
+func TestQuizServer_SubmitAnswerForwarded(t *testing.T) {
+	var forwarded *http.Request
+	var forwardedBody string
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded, forwardedBody = r, string(body)
+		writeJSON(w, map[string]string{"message": "Answer submitted successfully."})
+	}))
+	defer owner.Close()
+
+	registry := NewMemoryRegistry()
+	require.NoError(t, registry.RegisterNode(Node{ID: "owner", URL: owner.URL}))
+	require.NoError(t, registry.ClaimSession("session1", "owner"))
+	issuer := NewTokenIssuer([]byte("secret"), time.Hour)
+	qs := &QuizServer{TokenIssuer: issuer, registry: registry, nodeID: "other"}
+
+	token, _, err := issuer.Issue("player1", "session1")
+	require.NoError(t, err)
+	body := `{"sessionId":"session1","questionIndex":0,"answer":1}`
+	request := httptest.NewRequest(http.MethodPost, "/submit-answer", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	qs.SubmitAnswerHandler(recorder, request)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NotNil(t, forwarded)
+	require.Equal(t, "/submit-answer", forwarded.URL.Path)
+	require.Equal(t, "Bearer "+token, forwarded.Header.Get("Authorization"))
+	sessionId, ok := (&QuizServer{TokenIssuer: issuer}).isForwarded(forwarded)
+	require.True(t, ok)
+	require.Equal(t, "session1", sessionId)
+	require.Equal(t, body, forwardedBody)
+}
+
+// A forwarded-by value is only accepted for the request it was signed for, and only for a short
+// while, so it cannot be replayed to skip forwarding or the rate limit.
+func TestQuizServer_ForwardedByCannotBeReplayed(t *testing.T) {
+	issuer := NewTokenIssuer([]byte("secret"), time.Hour)
+	now := time.Now()
+	issuer.now = func() time.Time { return now }
+	qs := &QuizServer{TokenIssuer: issuer, nodeID: "node1.example.com"}
+	signed := httptest.NewRequest(http.MethodPost, protocol.SessionPath("session1", protocol.SessionAnswers), nil)
+	value := qs.forwardedBy(signed, "session1")
+
+	replay := func(method, path string) bool {
+		request := httptest.NewRequest(method, path, nil)
+		request.Header.Set(forwardedByHeader, value)
+		_, ok := qs.isForwarded(request)
+		if !ok {
+			require.Empty(t, request.Header.Get(forwardedByHeader))
+		}
+		return ok
+	}
+	require.True(t, replay(http.MethodPost, protocol.SessionPath("session1", protocol.SessionAnswers)))
+	require.False(t, replay(http.MethodPost, protocol.SessionPath("session2", protocol.SessionAnswers)))
+	require.False(t, replay(http.MethodDelete, protocol.SessionPath("session1", protocol.SessionAnswers)))
+
+	tampered, err := url.ParseQuery(value)
+	require.NoError(t, err)
+	tampered.Set("session", "session2")
+	request := httptest.NewRequest(http.MethodPost, protocol.SessionPath("session1", protocol.SessionAnswers), nil)
+	request.Header.Set(forwardedByHeader, tampered.Encode())
+	_, ok := qs.isForwarded(request)
+	require.False(t, ok)
+
+	now = now.Add(forwardedByMaxAge + time.Second)
+	require.False(t, replay(http.MethodPost, protocol.SessionPath("session1", protocol.SessionAnswers)))
+}
@@ -0,0 +1,287 @@
+package quiz_server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrResultNotFound = errors.New("session result not found")
+
+// AnswerRecord captures a single answer submitted during a session.
+type AnswerRecord struct {
+	PlayerID       string    `json:"playerId"`
+	QuestionIndex  int       `json:"questionIndex"`
+	Answer         int       `json:"answer"`
+	Correct        bool      `json:"correct"`
+	ResponseTimeMs int64     `json:"responseTimeMs"`
+	SubmittedAt    time.Time `json:"submittedAt"`
+}
+
+// PlayerResult is the final standing of a player in a completed session.
+type PlayerResult struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+}
+
+// SessionResult is everything recorded about a completed session.
+type SessionResult struct {
+	SessionID string         `json:"sessionId"`
+	StartedAt time.Time      `json:"startedAt"`
+	EndedAt   time.Time      `json:"endedAt"`
+	Questions []Question     `json:"questions"`
+	Players   []PlayerResult `json:"players"`
+	Answers   []AnswerRecord `json:"answers"`
+}
+
+// PlayerHistoryEntry summarises a single session from the point of view of one player.
+type PlayerHistoryEntry struct {
+	SessionID      string    `json:"sessionId"`
+	EndedAt        time.Time `json:"endedAt"`
+	Name           string    `json:"name"`
+	Score          int       `json:"score"`
+	CorrectAnswers int       `json:"correctAnswers"`
+	QuestionCount  int       `json:"questionCount"`
+}
+
+// ResultsStore persists the results of completed sessions.
+type ResultsStore interface {
+	SaveSessionResult(result SessionResult) error
+	GetSessionResult(sessionId string) (SessionResult, error)
+	GetPlayerHistory(playerId string) ([]PlayerHistoryEntry, error)
+	// ListSessionResults returns every result of a session that ended at or after since.
+	ListSessionResults(since time.Time) ([]SessionResult, error)
+}
+
+// FileResultsStore keeps one JSON file per session in a directory, with an in-memory index
+// loaded at startup so reads never touch the disk.
+type FileResultsStore struct {
+	dir     string
+	mutex   sync.RWMutex
+	results map[string]SessionResult
+}
+
+// NewFileResultsStore creates the directory if needed and loads any existing results from it.
+func NewFileResultsStore(dir string) (*FileResultsStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create results directory: %w", err)
+	}
+	store := &FileResultsStore{
+		dir:     dir,
+		results: make(map[string]SessionResult),
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		fileContent, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var result SessionResult
+		if err := json.Unmarshal(fileContent, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse result file %s: %w", file, err)
+		}
+		store.results[result.SessionID] = result
+	}
+	return store, nil
+}
+
+func (f *FileResultsStore) SaveSessionResult(result SessionResult) error {
+	if result.SessionID == "" || strings.ContainsAny(result.SessionID, `/\`) {
+		return fmt.Errorf("invalid session ID %q", result.SessionID)
+	}
+	jsonData, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// Write to a temporary file first so a crash never leaves a half written result behind.
+	path := filepath.Join(f.dir, result.SessionID+".json")
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, jsonData, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	f.results[result.SessionID] = result
+	return nil
+}
+
+func (f *FileResultsStore) GetSessionResult(sessionId string) (SessionResult, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	result, ok := f.results[sessionId]
+	if !ok {
+		return SessionResult{}, ErrResultNotFound
+	}
+	return result, nil
+}
+
+func (f *FileResultsStore) GetPlayerHistory(playerId string) ([]PlayerHistoryEntry, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return playerHistory(f.results, playerId), nil
+}
+
+func (f *FileResultsStore) ListSessionResults(since time.Time) ([]SessionResult, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return resultsSince(f.results, since), nil
+}
+
+// playerHistory summarises the sessions a player took part in, most recent first.
+func playerHistory(results map[string]SessionResult, playerId string) []PlayerHistoryEntry {
+	history := make([]PlayerHistoryEntry, 0)
+	for _, result := range results {
+		for _, player := range result.Players {
+			if player.ID != playerId {
+				continue
+			}
+			entry := PlayerHistoryEntry{
+				SessionID:     result.SessionID,
+				EndedAt:       result.EndedAt,
+				Name:          player.Name,
+				Score:         player.Score,
+				QuestionCount: len(result.Questions),
+			}
+			for _, answer := range result.Answers {
+				if answer.PlayerID == playerId && answer.Correct {
+					entry.CorrectAnswers++
+				}
+			}
+			history = append(history, entry)
+		}
+	}
+
+	// Most recent sessions first.
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].EndedAt.After(history[j].EndedAt)
+	})
+	return history
+}
+
+// resultsSince returns the results of the sessions that ended at or after since, oldest first.
+func resultsSince(results map[string]SessionResult, since time.Time) []SessionResult {
+	matching := make([]SessionResult, 0)
+	for _, result := range results {
+		if !result.EndedAt.Before(since) {
+			matching = append(matching, result)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].EndedAt.Before(matching[j].EndedAt)
+	})
+	return matching
+}
+
+// DirResultsStore keeps one JSON file per session in a directory shared by every node of a
+// cluster, like DirAccountStore. Unlike FileResultsStore it reads the directory on every call,
+// so the results saved by any node are seen by all of them.
+type DirResultsStore struct {
+	dir string
+}
+
+func NewDirResultsStore(dir string) (*DirResultsStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create results directory: %w", err)
+	}
+	return &DirResultsStore{dir: dir}, nil
+}
+
+func (d *DirResultsStore) path(sessionId string) (string, error) {
+	if sessionId == "" || strings.ContainsAny(sessionId, `/\.`) {
+		return "", fmt.Errorf("invalid session ID %q", sessionId)
+	}
+	return filepath.Join(d.dir, sessionId+".json"), nil
+}
+
+func (d *DirResultsStore) SaveSessionResult(result SessionResult) error {
+	path, err := d.path(result.SessionID)
+	if err != nil {
+		return err
+	}
+	jsonData, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, jsonData, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func readResult(path string) (SessionResult, error) {
+	fileContent, err := os.ReadFile(path)
+	if err != nil {
+		return SessionResult{}, err
+	}
+	var result SessionResult
+	if err := json.Unmarshal(fileContent, &result); err != nil {
+		return SessionResult{}, fmt.Errorf("failed to parse result file %s: %w", path, err)
+	}
+	return result, nil
+}
+
+func (d *DirResultsStore) GetSessionResult(sessionId string) (SessionResult, error) {
+	path, err := d.path(sessionId)
+	if err != nil {
+		return SessionResult{}, ErrResultNotFound
+	}
+	result, err := readResult(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return SessionResult{}, ErrResultNotFound
+	}
+	return result, err
+}
+
+// readAll reads every result of the directory.
+func (d *DirResultsStore) readAll() (map[string]SessionResult, error) {
+	files, err := filepath.Glob(filepath.Join(d.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]SessionResult, len(files))
+	for _, file := range files {
+		result, err := readResult(file)
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed by another node since the directory was listed.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results[result.SessionID] = result
+	}
+	return results, nil
+}
+
+func (d *DirResultsStore) GetPlayerHistory(playerId string) ([]PlayerHistoryEntry, error) {
+	results, err := d.readAll()
+	if err != nil {
+		return nil, err
+	}
+	return playerHistory(results, playerId), nil
+}
+
+func (d *DirResultsStore) ListSessionResults(since time.Time) ([]SessionResult, error) {
+	results, err := d.readAll()
+	if err != nil {
+		return nil, err
+	}
+	return resultsSince(results, since), nil
+}
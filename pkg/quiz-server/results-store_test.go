@@ -0,0 +1,84 @@
+package quiz_server
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// Results saved by one store should be readable by a fresh store opened on the same directory.
+func TestFileResultsStore_SaveAndReload(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileResultsStore(dir)
+	require.NoError(t, err)
+
+	endedAt := time.Now().UTC().Truncate(time.Second)
+	result := SessionResult{
+		SessionID: "session1",
+		EndedAt:   endedAt,
+		Questions: []Question{{Question: "Q1", PossibleAnswers: []string{"a", "b"}, CorrectAnswer: 1}},
+		Players: []PlayerResult{
+			{ID: "1", Name: "Alice", Score: 1},
+			{ID: "2", Name: "Bob", Score: 0},
+		},
+		Answers: []AnswerRecord{
+			{PlayerID: "1", QuestionIndex: 0, Answer: 1, Correct: true, ResponseTimeMs: 1200},
+			{PlayerID: "2", QuestionIndex: 0, Answer: 0, Correct: false, ResponseTimeMs: 800},
+		},
+	}
+	require.NoError(t, store.SaveSessionResult(result))
+
+	reloaded, err := NewFileResultsStore(dir)
+	require.NoError(t, err)
+
+	saved, err := reloaded.GetSessionResult("session1")
+	require.NoError(t, err)
+	require.Equal(t, result.Players, saved.Players)
+	require.Equal(t, result.Answers, saved.Answers)
+
+	history, err := reloaded.GetPlayerHistory("1")
+	require.NoError(t, err)
+	require.Equal(t, []PlayerHistoryEntry{{
+		SessionID:      "session1",
+		EndedAt:        endedAt,
+		Name:           "Alice",
+		Score:          1,
+		CorrectAnswers: 1,
+		QuestionCount:  1,
+	}}, history)
+
+	_, err = reloaded.GetSessionResult("missing")
+	require.ErrorIs(t, err, ErrResultNotFound)
+}
+
+// Results saved by one node must be seen by every node sharing the directory, without a restart.
+func TestDirResultsStore_SharedBetweenNodes(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDirResultsStore(dir)
+	require.NoError(t, err)
+	other, err := NewDirResultsStore(dir)
+	require.NoError(t, err)
+
+	endedAt := time.Now().UTC().Truncate(time.Second)
+	result := SessionResult{
+		SessionID: "session1",
+		EndedAt:   endedAt,
+		Players:   []PlayerResult{{ID: "1", Name: "Alice", Score: 1}},
+		Answers:   []AnswerRecord{{PlayerID: "1", Correct: true}},
+	}
+	require.NoError(t, store.SaveSessionResult(result))
+
+	saved, err := other.GetSessionResult("session1")
+	require.NoError(t, err)
+	require.Equal(t, result.Players, saved.Players)
+	history, err := other.GetPlayerHistory("1")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.Equal(t, 1, history[0].CorrectAnswers)
+	results, err := other.ListSessionResults(endedAt.Add(time.Second))
+	require.NoError(t, err)
+	require.Empty(t, results)
+
+	_, err = other.GetSessionResult("../session1")
+	require.ErrorIs(t, err, ErrResultNotFound)
+}
@@ -0,0 +1,86 @@
+package quiz_server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"the-quiz-game/pkg/protocol"
+)
+
+// route is a handler for a method and a path pattern. Pattern segments in braces, such as
+// {sessionId}, match any single segment and are available to the handler through pathParam.
+type route struct {
+	method   string
+	pattern  string
+	segments []string
+	handler  http.HandlerFunc
+}
+
+// router dispatches requests by method and path. Unlike http.ServeMux it answers unknown
+// paths and methods with the JSON errors of the API, and 405 responses list the allowed methods.
+type router struct {
+	routes []route
+}
+
+func (rt *router) handle(method, pattern string, handler http.HandlerFunc) {
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		pattern:  pattern,
+		segments: strings.Split(strings.Trim(pattern, "/"), "/"),
+		handler:  handler,
+	})
+}
+
+type pathParamsKey struct{}
+
+// pathParam returns a segment of the request path matched by a {name} pattern segment.
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
+}
+
+// match returns the path parameters of a route if it matches the path segments.
+func (rt *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(rt.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, segment := range rt.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[strings.Trim(segment, "{}")] = segments[i]
+		} else if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var allowed []string
+	for i := range rt.routes {
+		route := &rt.routes[i]
+		params, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		if route.method != r.Method {
+			allowed = append(allowed, route.method)
+			continue
+		}
+		route.handler(w, r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, params)))
+		return
+	}
+
+	if len(allowed) > 0 {
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeMethodNotAllowed(w)
+		return
+	}
+	writeError(w, http.StatusNotFound, protocol.ErrorCodeNotFound, "Not found.")
+}
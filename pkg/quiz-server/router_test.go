@@ -0,0 +1,80 @@
+package quiz_server
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"the-quiz-game/pkg/protocol"
+)
+
+// Requests must reach the handler of their method and path, with the parameters of the path.
+func TestRouter_ServeHTTP(t *testing.T) {
+	var sessionId string
+	rt := &router{}
+	rt.handle(http.MethodPost, "/api/v1/sessions/{sessionId}/answers", func(w http.ResponseWriter, r *http.Request) {
+		sessionId = pathParam(r, "sessionId")
+	})
+	rt.handle(http.MethodGet, "/api/v1/sessions/{sessionId}/answers", func(w http.ResponseWriter, r *http.Request) {})
+
+	recorder := httptest.NewRecorder()
+	rt.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/sessions/session1/answers", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "session1", sessionId)
+
+	recorder = httptest.NewRecorder()
+	rt.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/api/v1/sessions/session1/answers", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	require.Equal(t, "GET, POST", recorder.Header().Get("Allow"))
+
+	for _, path := range []string{"/api/v1/sessions//answers", "/api/v1/sessions/session1", "/api/v1/sessions/session1/answers/extra"} {
+		recorder = httptest.NewRecorder()
+		rt.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, nil))
+		require.Equal(t, http.StatusNotFound, recorder.Code, path)
+		var response protocol.ErrorResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		require.Equal(t, protocol.ErrorCodeNotFound, response.Code)
+	}
+}
+
+// Every route of the versioned API must be in the OpenAPI document, and the other way round.
+func TestRouter_MatchesOpenAPI(t *testing.T) {
+	var document struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(protocol.OpenAPI, &document))
+	var documented []string
+	for path, operations := range document.Paths {
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	var routed []string
+	for _, route := range (&QuizServer{}).newRouter().routes {
+		if path, ok := strings.CutPrefix(route.pattern, protocol.APIPrefix); ok {
+			routed = append(routed, route.method+" "+path)
+		}
+	}
+	require.ElementsMatch(t, documented, routed)
+}
+
+// Requests with fields the API does not define, or failing validation, are rejected.
+func TestDecodeRequest(t *testing.T) {
+	for body, valid := range map[string]bool{
+		`{"questionIndex": 1, "answer": 2}`:                true,
+		`{"questionIndex": 1, "answer": 2, "extra": true}`: false,
+		`{"questionIndex": -1, "answer": 2}`:               false,
+		`{"questionIndex": "first", "answer": 2}`:          false,
+	} {
+		var request protocol.SubmitAnswerRequest
+		recorder := httptest.NewRecorder()
+		ok := decodeRequest(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), &request)
+		require.Equal(t, valid, ok, body)
+		if !valid {
+			require.Equal(t, http.StatusBadRequest, recorder.Code, body)
+		}
+	}
+}
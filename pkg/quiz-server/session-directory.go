@@ -0,0 +1,71 @@
+package quiz_server
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// sessionDirectoryShards is the number of independently locked shards of a sessionDirectory.
+const sessionDirectoryShards = 32
+
+// sessionDirectory finds the running sessions of a manager by ID. The manager adds and removes
+// sessions, request handlers look them up concurrently without going through the manager, so
+// the directory is split into shards that each have their own lock.
+type sessionDirectory struct {
+	shards [sessionDirectoryShards]sessionDirectoryShard
+}
+
+type sessionDirectoryShard struct {
+	mutex    sync.RWMutex
+	sessions map[string]*Session
+}
+
+func newSessionDirectory() *sessionDirectory {
+	d := &sessionDirectory{}
+	for i := range d.shards {
+		d.shards[i].sessions = make(map[string]*Session)
+	}
+	return d
+}
+
+func (d *sessionDirectory) shard(sessionId string) *sessionDirectoryShard {
+	hash := fnv.New32a()
+	hash.Write([]byte(sessionId))
+	return &d.shards[hash.Sum32()%sessionDirectoryShards]
+}
+
+func (d *sessionDirectory) add(session *Session) {
+	shard := d.shard(session.ID)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	shard.sessions[session.ID] = session
+}
+
+func (d *sessionDirectory) remove(sessionId string) {
+	shard := d.shard(sessionId)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	delete(shard.sessions, sessionId)
+}
+
+func (d *sessionDirectory) get(sessionId string) (*Session, bool) {
+	shard := d.shard(sessionId)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	session, ok := shard.sessions[sessionId]
+	return session, ok
+}
+
+// list returns every session of the directory, in no particular order.
+func (d *sessionDirectory) list() []*Session {
+	var sessions []*Session
+	for i := range d.shards {
+		shard := &d.shards[i]
+		shard.mutex.RLock()
+		for _, session := range shard.sessions {
+			sessions = append(sessions, session)
+		}
+		shard.mutex.RUnlock()
+	}
+	return sessions
+}
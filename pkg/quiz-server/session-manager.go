@@ -5,33 +5,65 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ably/ably-go/ably"
+	"the-quiz-game/pkg/signing"
 	"time"
 )
 
 type SessionManagerCommandType int
 
 const (
-	SubmitAnswer SessionManagerCommandType = iota
-	JoinSession
+	JoinSession SessionManagerCommandType = iota
 	MoveSessionToInProgress
 	EndSession
+	SpectateSession
+	DrainSessions
+	StopSessions
 )
 
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrShuttingDown    = errors.New("server is shutting down, no new sessions can be joined")
+	ErrTooManySessions = errors.New("max sessions reached, could not create a session to join")
+	// ErrCommandNotAccepted and ErrCommandTimeout wrap the context error of a command whose
+	// caller gave up, before and after the command was handed over.
+	ErrCommandNotAccepted = errors.New("the server is too busy to take the request")
+	ErrCommandTimeout     = errors.New("timed out waiting for the request to be handled")
+)
+
+// shutdownMessage is the quiz-end message of sessions stopped because the server shuts down.
+const shutdownMessage = "server shutting down"
+
 type SessionManagerCommand struct {
-	CommandType  SessionManagerCommandType
-	player       Player
-	answer       int
-	SessionId    string
+	// ctx is the context of the caller, commands whose caller has gone away are skipped.
+	ctx         context.Context
+	CommandType SessionManagerCommandType
+	player      Player
+	SessionId   string
+	// client identifies who joins, the sessions created for a client are limited.
+	client       string
 	ResponseChan chan<- SessionManagerResponse
 }
 
 type SessionManagerResponse struct {
 	Error     error
 	SessionId string
+	// PlayerName is the name a joining player was given, made unique within the session.
+	PlayerName string
 }
 
+// sessionEventQueueSize is how many lifecycle changes sessions can report before the manager
+// handles them, sessions only wait for the manager once it is that far behind.
+const sessionEventQueueSize = 256
+
+// SessionManager handles the lifecycle of sessions: joins, spectators, moving full sessions to
+// in progress and ending them. Answers never go through it, each session scores its own answers
+// and handlers find the session in the directory.
 type SessionManager struct {
-	CommandChan          chan SessionManagerCommand
+	CommandChan chan SessionManagerCommand
+	// sessionEvents carries the lifecycle changes reported by sessions, which never wait for a
+	// response, so a session ending while the manager is busy cannot deadlock with it.
+	sessionEvents        chan SessionManagerCommand
+	directory            *sessionDirectory
 	waitingRooms         map[string]*Session
 	inProgress           map[string]*Session
 	maxPlayersPerSession int
@@ -39,65 +71,334 @@ type SessionManager struct {
 	maxSessions          int
 	ablyConnection       *ably.Realtime
 	questions            []Question
+	resultsStore         ResultsStore
+	eventSigner          *signing.Signer
+	// hideStandingsQuestions is the number of final questions of each session without standings.
+	hideStandingsQuestions int
+	snapshotStore          SnapshotStore
+	snapshotInterval       time.Duration
+	registry               SessionRegistry
+	nodeID                 string
+	answerQueueSize        int
+	waitingRoomTimeout     time.Duration
+	maxSessionLifetime     time.Duration
+	// sessionClients records the client each session was created for, clientSessions how many
+	// sessions of each client are running.
+	maxSessionsPerClient int
+	sessionClients       map[string]string
+	clientSessions       map[string]int
+	// Once draining no sessions can be joined, drained is closed when the last session ended.
+	draining      bool
+	drained       chan struct{}
+	drainedClosed bool
+}
+
+// SessionManagerConfig holds everything needed to create a SessionManager.
+type SessionManagerConfig struct {
+	MaxSessions          int
+	MaxPlayersPerSession int
+	AblyConnection       *ably.Realtime
+	Questions            []Question
+	ResultsStore         ResultsStore
+	EventSigner          *signing.Signer
+	// HideStandingsQuestions is the number of final questions of each session without standings.
+	HideStandingsQuestions int
+	// SnapshotStore keeps the state of every session every SnapshotInterval, so sessions can be
+	// restored when the server restarts. Sessions are not snapshotted if it is nil.
+	SnapshotStore    SnapshotStore
+	SnapshotInterval time.Duration
+	// AnswerQueueSize is how many answers each session queues before refusing more.
+	AnswerQueueSize int
+	// Registry records that the sessions of this manager are owned by the node NodeID, so other
+	// nodes can forward their requests here. Sessions are not registered if it is nil.
+	Registry SessionRegistry
+	NodeID   string
+	// MaxSessionsPerClient caps the running sessions created for one client, 0 for no limit.
+	MaxSessionsPerClient int
+	// WaitingRoomTimeout ends waiting rooms nobody joined for that long, MaxSessionLifetime
+	// ends sessions that ran for that long. Zero disables them.
+	WaitingRoomTimeout time.Duration
+	MaxSessionLifetime time.Duration
 }
 
-func NewSessionManager(maxSessions int, maxPlayersPerSession int, ablyConnection *ably.Realtime, loadedQuestions []Question) *SessionManager {
+// NewSessionManager creates a SessionManager, restoring the sessions of the snapshot store.
+func NewSessionManager(config SessionManagerConfig) *SessionManager {
 	commandChan := make(chan SessionManagerCommand)
 	waitingRooms := make(map[string]*Session)
 	inProgress := make(map[string]*Session)
 	qs := &SessionManager{
-		CommandChan:          commandChan,
-		waitingRooms:         waitingRooms,
-		inProgress:           inProgress,
-		maxSessions:          maxSessions,
-		maxPlayersPerSession: maxPlayersPerSession,
-		ablyConnection:       ablyConnection,
-		questions:            loadedQuestions,
+		CommandChan:            commandChan,
+		sessionEvents:          make(chan SessionManagerCommand, sessionEventQueueSize),
+		directory:              newSessionDirectory(),
+		waitingRooms:           waitingRooms,
+		inProgress:             inProgress,
+		maxSessions:            config.MaxSessions,
+		maxPlayersPerSession:   config.MaxPlayersPerSession,
+		ablyConnection:         config.AblyConnection,
+		questions:              config.Questions,
+		resultsStore:           config.ResultsStore,
+		eventSigner:            config.EventSigner,
+		hideStandingsQuestions: config.HideStandingsQuestions,
+		snapshotStore:          config.SnapshotStore,
+		snapshotInterval:       config.SnapshotInterval,
+		registry:               config.Registry,
+		nodeID:                 config.NodeID,
+		answerQueueSize:        config.AnswerQueueSize,
+		maxSessionsPerClient:   config.MaxSessionsPerClient,
+		waitingRoomTimeout:     config.WaitingRoomTimeout,
+		maxSessionLifetime:     config.MaxSessionLifetime,
+		sessionClients:         make(map[string]string),
+		clientSessions:         make(map[string]int),
+		drained:                make(chan struct{}),
 	}
+	qs.restoreSessions()
 	go qs.RunSessionManager()
 	return qs
 }
 
 func (s *SessionManager) RunSessionManager() {
 	fmt.Printf("Starting session manager \n")
-	for cmd := range s.CommandChan {
+	for {
+		var cmd SessionManagerCommand
+		select {
+		case cmd = <-s.CommandChan:
+		case cmd = <-s.sessionEvents:
+		}
+		if cmd.ctx != nil && cmd.ctx.Err() != nil {
+			fmt.Printf("Skipping SessionManagerCommand %v, its caller has gone away\n", cmd.CommandType)
+			continue
+		}
 		fmt.Printf("Handling SessionManagerCommand %v\n", cmd)
 		response := s.handleCommand(cmd)
-		cmd.ResponseChan <- response
+		if cmd.ResponseChan != nil {
+			cmd.ResponseChan <- response
+		}
+	}
+}
+
+// Send hands a command to the manager and waits for its response, giving up once ctx is done.
+func (s *SessionManager) Send(ctx context.Context, cmd SessionManagerCommand) (SessionManagerResponse, error) {
+	// The response channel is buffered, so the manager never waits for a caller that gave up.
+	responseChan := make(chan SessionManagerResponse, 1)
+	cmd.ctx = ctx
+	cmd.ResponseChan = responseChan
+	select {
+	case s.CommandChan <- cmd:
+	case <-ctx.Done():
+		return SessionManagerResponse{}, fmt.Errorf("%w: %w", ErrCommandNotAccepted, ctx.Err())
+	}
+	select {
+	case response := <-responseChan:
+		return response, nil
+	case <-ctx.Done():
+		return SessionManagerResponse{}, fmt.Errorf("%w: %w", ErrCommandTimeout, ctx.Err())
+	}
+}
+
+// Session returns a running session, it is safe to call from any goroutine.
+func (s *SessionManager) Session(sessionId string) (*Session, bool) {
+	return s.directory.get(sessionId)
+}
+
+// SubmitAnswer hands an answer to the session it is for, which scores it.
+func (s *SessionManager) SubmitAnswer(ctx context.Context, sessionId string, player Player, answer Answer) error {
+	session, ok := s.Session(sessionId)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return session.Submit(ctx, player, answer)
+}
+
+// LeaveSession removes a player from a session, see Session.Leave.
+func (s *SessionManager) LeaveSession(sessionId, playerId string) error {
+	session, ok := s.Session(sessionId)
+	if !ok {
+		return ErrSessionNotFound
 	}
+	return session.Leave(playerId)
 }
 
-func (s *SessionManager) createSession() (string, error) {
+// Sessions returns every running session, it is safe to call from any goroutine.
+func (s *SessionManager) Sessions() []*Session {
+	return s.directory.list()
+}
+
+// Drain stops new players joining and ends every session still waiting for players, sessions in
+// progress play on. Drained is closed once every session has ended.
+func (s *SessionManager) Drain() {
+	s.sendCommand(DrainSessions)
+}
+
+// Drained is closed once the manager is draining and every session has ended.
+func (s *SessionManager) Drained() <-chan struct{} {
+	return s.drained
+}
+
+// StopSessions ends every session in progress, telling players the server is shutting down.
+func (s *SessionManager) StopSessions() {
+	s.sendCommand(StopSessions)
+}
+
+func (s *SessionManager) sendCommand(commandType SessionManagerCommandType) {
+	s.Send(context.Background(), SessionManagerCommand{CommandType: commandType})
+}
+
+// closeDrainedIfIdle closes drained once draining and no session is left.
+func (s *SessionManager) closeDrainedIfIdle() {
+	if s.draining && s.activeCount == 0 && !s.drainedClosed {
+		s.drainedClosed = true
+		close(s.drained)
+	}
+}
+
+// createSession creates a waiting room for a client, which may be empty if unknown.
+func (s *SessionManager) createSession(client string) (string, error) {
 	if s.activeCount >= s.maxSessions {
-		return "", errors.New("max sessions reached, could not create a session to join")
+		return "", ErrTooManySessions
+	}
+	if client != "" && s.maxSessionsPerClient > 0 && s.clientSessions[client] >= s.maxSessionsPerClient {
+		return "", ErrClientSessionLimit
 	}
 	// Logic to create a new session and its SessionManagerCommand channel
 	sessionID := generateUniqueID()
-	sessionConfig := SessionConfig{
-		maxPlayersPerSession: s.maxPlayersPerSession,
-		maxTimePerQuestion:   3 * time.Second,
-		questions:            s.questions,
-	}
-	sessionAblyChannel := s.ablyConnection.Channels.Get(sessionID)
+	sessionAblyChannel := newSignedChannel(s.ablyConnection.Channels.Get(sessionID), s.eventSigner, sessionID)
 	ctx, cancel := context.WithCancel(context.Background())
-	session := NewSession(sessionID, sessionConfig, s.CommandChan, sessionAblyChannel, cancel, ctx)
+	session := NewSession(sessionID, s.sessionConfig(s.questions), s.sessionEvents, sessionAblyChannel, cancel, ctx)
 	s.waitingRooms[sessionID] = session
+	s.directory.add(session)
+	go session.runSnapshots(s.snapshotInterval)
+	go session.runExpiry()
+	s.claimSession(sessionID)
+	if client != "" {
+		s.sessionClients[sessionID] = client
+		s.clientSessions[client]++
+	}
 
 	s.activeCount++
 	return sessionID, nil
 }
 
+// joinSession adds a player to the given session, as long as it waits for players.
+func (s *SessionManager) joinSession(sessionId string, player Player) SessionManagerResponse {
+	session, ok := s.waitingRooms[sessionId]
+	if !ok {
+		if _, inProgress := s.inProgress[sessionId]; inProgress {
+			return SessionManagerResponse{Error: ErrSessionFull}
+		}
+		return SessionManagerResponse{Error: ErrSessionNotFound}
+	}
+	err := session.AddPlayer(player)
+	return SessionManagerResponse{Error: err, SessionId: sessionId, PlayerName: session.playerName(player.ID)}
+}
+
+// claimSession registers this node as the owner of a session.
+func (s *SessionManager) claimSession(sessionID string) {
+	if s.registry == nil {
+		return
+	}
+	if err := s.registry.ClaimSession(sessionID, s.nodeID); err != nil {
+		fmt.Printf("Error registering session %s: %v\n", sessionID, err)
+	}
+}
+
+func (s *SessionManager) releaseSession(sessionID string) {
+	if s.registry == nil {
+		return
+	}
+	if err := s.registry.ReleaseSession(sessionID); err != nil {
+		fmt.Printf("Error unregistering session %s: %v\n", sessionID, err)
+	}
+}
+
+func (s *SessionManager) sessionConfig(questions []Question) SessionConfig {
+	return SessionConfig{
+		maxPlayersPerSession:   s.maxPlayersPerSession,
+		maxTimePerQuestion:     3 * time.Second,
+		questions:              questions,
+		resultsStore:           s.resultsStore,
+		hideStandingsQuestions: s.hideStandingsQuestions,
+		snapshotStore:          s.snapshotStore,
+		answerQueueSize:        s.answerQueueSize,
+		idleTimeout:            s.waitingRoomTimeout,
+		maxLifetime:            s.maxSessionLifetime,
+	}
+}
+
+// restoreSessions recreates the sessions of the snapshot store after a restart and resumes
+// their games. It runs before the manager starts handling commands.
+func (s *SessionManager) restoreSessions() {
+	if s.snapshotStore == nil {
+		return
+	}
+	snapshots, err := s.snapshotStore.ListSnapshots()
+	if err != nil {
+		fmt.Printf("Error loading session snapshots: %v\n", err)
+		return
+	}
+	for _, snapshot := range snapshots {
+		fmt.Printf("Restoring session %s\n", snapshot.SessionID)
+		channel := newSignedChannel(s.ablyConnection.Channels.Get(snapshot.SessionID), s.eventSigner, snapshot.SessionID)
+		// Events may have been published after the snapshot, skip past their sequence numbers.
+		channel.sequence = snapshot.Sequence + resumeSequenceGap
+		ctx, cancel := context.WithCancel(context.Background())
+		session := restoreSession(snapshot, s.sessionConfig(snapshot.Questions), s.sessionEvents, channel, cancel, ctx)
+		if snapshot.State == SessionInProgress {
+			s.inProgress[session.ID] = session
+		} else {
+			s.waitingRooms[session.ID] = session
+		}
+		s.directory.add(session)
+		s.activeCount++
+		s.claimSession(session.ID)
+		go session.resume()
+		go session.runSnapshots(s.snapshotInterval)
+		go session.runExpiry()
+	}
+}
+
 func (s *SessionManager) handleCommand(cmd SessionManagerCommand) SessionManagerResponse {
 	switch cmd.CommandType {
 	case EndSession:
 		fmt.Printf("Ending session %s\n", cmd.SessionId)
-		// Logic to move a session from in-progress to waiting
-		_, ok := s.inProgress[cmd.SessionId]
-		if !ok {
+		// Sessions stopped while waiting for players end from the waiting rooms.
+		_, inProgress := s.inProgress[cmd.SessionId]
+		_, waiting := s.waitingRooms[cmd.SessionId]
+		if !inProgress && !waiting {
 			fmt.Printf("Session %s not found, cannot end session\n", cmd.SessionId)
+			return SessionManagerResponse{Error: nil}
 		}
 		s.activeCount--
 		delete(s.inProgress, cmd.SessionId)
+		delete(s.waitingRooms, cmd.SessionId)
+		s.directory.remove(cmd.SessionId)
+		s.releaseSession(cmd.SessionId)
+		if client, ok := s.sessionClients[cmd.SessionId]; ok {
+			delete(s.sessionClients, cmd.SessionId)
+			if s.clientSessions[client]--; s.clientSessions[client] == 0 {
+				delete(s.clientSessions, client)
+			}
+		}
+		s.closeDrainedIfIdle()
+		return SessionManagerResponse{Error: nil}
+
+	case DrainSessions:
+		fmt.Printf("Draining sessions, %d in progress\n", len(s.inProgress))
+		s.draining = true
+		// Stopping a session ends it through this goroutine, so it must happen in the background.
+		for _, session := range s.waitingRooms {
+			go session.Stop(shutdownMessage)
+		}
+		s.closeDrainedIfIdle()
+		return SessionManagerResponse{Error: nil}
+
+	case StopSessions:
+		fmt.Printf("Stopping %d sessions in progress\n", len(s.inProgress))
+		for _, session := range s.inProgress {
+			go session.Stop(shutdownMessage)
+		}
+		for _, session := range s.waitingRooms {
+			go session.Stop(shutdownMessage)
+		}
 		return SessionManagerResponse{Error: nil}
 
 	case MoveSessionToInProgress:
@@ -105,49 +406,59 @@ func (s *SessionManager) handleCommand(cmd SessionManagerCommand) SessionManager
 		fmt.Printf("Moving session %s to in progress\n", cmd.SessionId)
 		session, ok := s.waitingRooms[cmd.SessionId]
 		if !ok {
-			return SessionManagerResponse{Error: errors.New("session not found")}
+			return SessionManagerResponse{Error: ErrSessionNotFound}
 		}
 		s.inProgress[cmd.SessionId] = session
 		delete(s.waitingRooms, cmd.SessionId)
 		return SessionManagerResponse{Error: nil}
 
-	case SubmitAnswer:
-		// Logic to submit a SessionManagerCommand to a session
-		fmt.Printf("Submitting answer %v to session %s\n", cmd.answer, cmd.SessionId)
-		session, ok := s.inProgress[cmd.SessionId]
-		if !ok {
-			return SessionManagerResponse{Error: errors.New("session not found")}
-		}
-		return SessionManagerResponse{Error: session.SubmitAnswer(cmd.player, cmd.answer)}
-
 	case JoinSession:
+		if s.draining {
+			return SessionManagerResponse{Error: ErrShuttingDown}
+		}
+		if cmd.SessionId != "" {
+			return s.joinSession(cmd.SessionId, cmd.player)
+		}
 		var sessionToJoin *Session
 		var sessionToJoinID string
 
-		// Check if there are any available waiting rooms
-		if len(s.waitingRooms) > 0 {
-			// Get the first available waiting room
-			for id, session := range s.waitingRooms {
+		// Get the first available waiting room, skipping those ending as they expired and those
+		// already full, whose move to in progress may not have been handled yet.
+		for id, session := range s.waitingRooms {
+			if session.isOpen() {
 				sessionToJoin = session
 				sessionToJoinID = id
 				break
 			}
-
+		}
+		if sessionToJoin != nil {
 			// Add the player to the selected waiting room
 			err := sessionToJoin.AddPlayer(cmd.player)
-			return SessionManagerResponse{Error: err, SessionId: sessionToJoinID}
+			return SessionManagerResponse{Error: err, SessionId: sessionToJoinID, PlayerName: sessionToJoin.playerName(cmd.player.ID)}
 		}
 
 		// If no waiting rooms are available, create a new one
 		fmt.Printf("Creating a new session\n")
-		sessionID, err := s.createSession()
+		sessionID, err := s.createSession(cmd.client)
 		if err != nil {
 			return SessionManagerResponse{Error: err}
 		}
 
 		// Add the player to the newly created waiting room
 		err = s.waitingRooms[sessionID].AddPlayer(cmd.player)
-		return SessionManagerResponse{Error: err, SessionId: sessionID}
+		return SessionManagerResponse{Error: err, SessionId: sessionID, PlayerName: s.waitingRooms[sessionID].playerName(cmd.player.ID)}
+
+	case SpectateSession:
+		// Spectators can watch waiting and in progress sessions, they never take a player slot.
+		session, ok := s.waitingRooms[cmd.SessionId]
+		if !ok {
+			session, ok = s.inProgress[cmd.SessionId]
+		}
+		if !ok {
+			return SessionManagerResponse{Error: ErrSessionNotFound}
+		}
+		session.AddSpectator(cmd.player.ID)
+		return SessionManagerResponse{SessionId: cmd.SessionId}
 
 	default:
 		return SessionManagerResponse{Error: errors.New("unknown SessionManagerCommand")}
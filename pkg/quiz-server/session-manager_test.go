@@ -0,0 +1,150 @@
+package quiz_server
+
+import (
+	"context"
+	"fmt"
+	"github.com/ably/ably-go/ably"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"the-quiz-game/pkg/events"
+	"time"
+)
+
+// Draining must end the waiting rooms, telling their players why, and refuse new players.
+func TestSessionManager_Drain(t *testing.T) {
+	manager := NewSessionManager(SessionManagerConfig{MaxSessions: 1, MaxPlayersPerSession: 2})
+
+	mockChannel := new(MockRealtimeChannel)
+	mockChannel.On("Publish", mock.Anything, string(events.QuizEnd), events.QuizEndPayload{Message: shutdownMessage}).Return(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	session := NewSession("waiting", SessionConfig{maxPlayersPerSession: 2}, manager.sessionEvents, mockChannel, cancel, ctx)
+	require.NoError(t, session.AddPlayer(Player{ID: "1", Name: "Alice"}))
+	addWaitingRoom(manager, session)
+
+	manager.Drain()
+	select {
+	case <-manager.Drained():
+	case <-time.After(time.Second):
+		t.Fatal("manager did not drain")
+	}
+	require.Eventually(t, func() bool { return ctx.Err() != nil }, time.Second, 10*time.Millisecond)
+	mockChannel.AssertExpectations(t)
+
+	responseChan := make(chan SessionManagerResponse)
+	manager.CommandChan <- SessionManagerCommand{
+		CommandType:  JoinSession,
+		player:       Player{ID: "2", Name: "Bob"},
+		ResponseChan: responseChan,
+	}
+	require.ErrorIs(t, (<-responseChan).Error, ErrShuttingDown)
+}
+
+// addWaitingRoom adds a session to the waiting rooms of a manager as if it had created it. Tests
+// set up the manager's state directly like this, or call its methods such as createSession: it
+// only touches its maps when handling a command, so this is safe between commands.
+func addWaitingRoom(manager *SessionManager, session *Session) {
+	manager.waitingRooms[session.ID] = session
+	manager.directory.add(session)
+	manager.activeCount++
+}
+
+// newTestAblyConnection returns a realtime client that never connects, enough to create channels.
+func newTestAblyConnection(t *testing.T) *ably.Realtime {
+	client, err := ably.NewRealtime(ably.WithKey("app.key:secret"), ably.WithAutoConnect(false))
+	require.NoError(t, err)
+	return client
+}
+
+// Joining any session must skip a waiting room that filled up before its move to in progress
+// was handled, rather than fail with ErrSessionFull.
+func TestSessionManager_JoinSkipsFullWaitingRoom(t *testing.T) {
+	manager := NewSessionManager(SessionManagerConfig{MaxSessions: 2, MaxPlayersPerSession: 2, AblyConnection: newTestAblyConnection(t)})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	full := NewSession("full", SessionConfig{maxPlayersPerSession: 1}, nil, discardChannel{}, cancel, ctx)
+	full.mutex.Lock()
+	full.players["1"] = Player{ID: "1", Name: "Alice"}
+	full.started = true
+	full.mutex.Unlock()
+	addWaitingRoom(manager, full)
+
+	response, err := manager.Send(context.Background(), SessionManagerCommand{
+		CommandType: JoinSession,
+		player:      Player{ID: "2", Name: "Bob"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, response.Error)
+	require.NotEqual(t, full.ID, response.SessionId)
+}
+
+// Commands whose caller gave up before the manager got to them must not be handled.
+func TestSessionManager_SkipsAbandonedCommands(t *testing.T) {
+	manager := NewSessionManager(SessionManagerConfig{MaxSessions: 1, MaxPlayersPerSession: 2, AblyConnection: newTestAblyConnection(t)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	abandoned := make(chan SessionManagerResponse, 1)
+	manager.CommandChan <- SessionManagerCommand{
+		ctx:          ctx,
+		CommandType:  JoinSession,
+		player:       Player{ID: "1", Name: "Alice"},
+		ResponseChan: abandoned,
+	}
+
+	response, err := manager.Send(context.Background(), SessionManagerCommand{
+		CommandType: JoinSession,
+		player:      Player{ID: "2", Name: "Bob"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, response.Error)
+	require.Empty(t, abandoned)
+	session, ok := manager.Session(response.SessionId)
+	require.True(t, ok)
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	require.Len(t, session.players, 1)
+}
+
+// Callers must not wait forever on a manager that is stuck.
+func TestSessionManager_SendTimeout(t *testing.T) {
+	// The manager's loop is not running, so nothing takes the command.
+	manager := &SessionManager{CommandChan: make(chan SessionManagerCommand)}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := manager.Send(ctx, SessionManagerCommand{CommandType: JoinSession})
+	require.ErrorIs(t, err, ErrCommandNotAccepted)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// Answers for many sessions are scored by their sessions in parallel, without the manager.
+func BenchmarkSessionManager_SubmitAnswer(b *testing.B) {
+	const sessions = 64
+	manager := NewSessionManager(SessionManagerConfig{MaxSessions: sessions})
+	playersPerSession := b.N/sessions + 1
+	for i := 0; i < sessions; i++ {
+		manager.directory.add(newBenchmarkSession(fmt.Sprint("session", i), playersPerSession))
+	}
+	var next int64 = -1
+	var scored int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := atomic.AddInt64(&next, 1)
+			sessionId := fmt.Sprint("session", n%sessions)
+			player := Player{ID: fmt.Sprint(n / sessions)}
+			switch err := manager.SubmitAnswer(context.Background(), sessionId, player, Answer{AnswerChoice: 1}); err {
+			case nil:
+				atomic.AddInt64(&scored, 1)
+			case ErrSessionBusy:
+				// Refused answers are not scored, so they do not count toward the rate.
+			default:
+				b.Fatal(err)
+			}
+		}
+	})
+	b.ReportMetric(float64(scored)/b.Elapsed().Seconds(), "answers/s")
+	b.ReportMetric(float64(int64(b.N)-scored)/float64(b.N), "refused/op")
+}
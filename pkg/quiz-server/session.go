@@ -2,24 +2,52 @@ package quiz_server
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
+	"the-quiz-game/pkg/events"
 	"time"
 )
 
+var (
+	ErrNoActiveQuestion = errors.New("no question is open for answers")
+	ErrWrongQuestion    = errors.New("answer is for a question other than the current one")
+	ErrLateAnswer       = errors.New("answer arrived after the question closed")
+	ErrAnswerOutOfRange = errors.New("answer is not one of the possible answers")
+	ErrSessionBusy      = errors.New("session has too many answers queued, try again")
+	ErrPlayerNotFound   = errors.New("player is not in the session")
+	ErrAlreadyAnswered  = errors.New("player has already answered the question")
+	ErrSessionFull      = errors.New("session has reached its maximum number of players")
+)
+
+// defaultAnswerQueueSize is how many answers a session queues when not configured otherwise.
+const defaultAnswerQueueSize = 1024
+
 type Player struct {
-	Name     string
-	ID       string
-	Score    int
+	Name  string
+	ID    string
+	Score int
+	// Streak is the number of questions in a row the player answered correctly.
+	Streak   int
 	hasVoted bool
+	// left is set once the player left the game in progress, their score still counts.
+	left bool
 }
 
 type SessionConfig struct {
 	maxPlayersPerSession int
 	maxTimePerQuestion   time.Duration
 	questions            []Question
+	resultsStore         ResultsStore
+	// hideStandingsQuestions hides the standings after the final questions to keep the suspense.
+	hideStandingsQuestions int
+	snapshotStore          SnapshotStore
+	// answerQueueSize is how many answers can wait for the session's answer loop.
+	answerQueueSize int
+	// idleTimeout ends waiting rooms no player joined for that long, maxLifetime ends sessions
+	// running for longer, see runExpiry. Zero disables them.
+	idleTimeout time.Duration
+	maxLifetime time.Duration
 }
 
 // RealtimeChannel for easier mocking tests.
@@ -30,30 +58,80 @@ type Session struct {
 	SessionConfig
 	ID              string
 	players         map[string]Player
+	spectators      int // only counted, spectators are identified by their tokens
 	currentQuestion int
-	quizManagerChan chan SessionManagerCommand
+	// quizManagerChan reports lifecycle changes to the session manager, without waiting for it.
+	quizManagerChan chan<- SessionManagerCommand
+	answerQueue     chan answerRequest
 	mutex           sync.Mutex
 	publishChannel  RealtimeChannel
 	ctx             context.Context
 	cancel          context.CancelFunc
+	// started is set once the session is full and its game loop runs. Closing stopping ends
+	// the game loop early with stopMessage as the reason. finishing is set once the session
+	// ends, it can no longer be stopped. stopping is only closed with the mutex held, see stopIf.
+	started     bool
+	finishing   bool
+	stopping    chan struct{}
+	stopMessage string
+	// lastJoin is when the session was created or a player last joined it.
+	lastJoin time.Time
+	// snapshotMutex orders snapshots with the removal of the snapshot once the session ended.
+	snapshotMutex sync.Mutex
+	ended         bool
+	// Timings and answers kept so the session can be recorded once it completes.
+	startedAt         time.Time
+	questionStartedAt time.Time
+	questionDeadline  time.Time
+	questionOpen      bool
+	// askedQuestions maps the ID published with each question to its index.
+	askedQuestions map[string]int
+	answers        []AnswerRecord
+	// answered counts the players who answered the current question, leftCount the players who
+	// left the game.
+	answered  int
+	leftCount int
+	// Scores and ranks of the last standings, to report how they changed.
+	lastScores map[string]int
+	lastRanks  map[string]int
 }
 
+// Answer is a player's choice for a question, identified by the question ID published with it
+// or, when the ID is empty, by the question index.
 type Answer struct {
-	AnswerChoice    int `json:"answerChoice"`
-	CurrentQuestion int `json:"currentQuestion"`
+	AnswerChoice    int    `json:"answerChoice"`
+	CurrentQuestion int    `json:"currentQuestion"`
+	QuestionID      string `json:"questionId"`
 }
 
-func NewSession(session string, sessionConfig SessionConfig, quizManagerChan chan SessionManagerCommand, ablyChannel RealtimeChannel, cancel context.CancelFunc, ctx context.Context) *Session {
+// answerRequest is an answer queued for the session's answer loop, the outcome is sent on result.
+type answerRequest struct {
+	ctx    context.Context
+	player Player
+	answer Answer
+	result chan error
+}
+
+// NewSession creates a session and starts its answer loop, which runs until ctx is done.
+func NewSession(session string, sessionConfig SessionConfig, quizManagerChan chan<- SessionManagerCommand, ablyChannel RealtimeChannel, cancel context.CancelFunc, ctx context.Context) *Session {
+	if sessionConfig.answerQueueSize <= 0 {
+		sessionConfig.answerQueueSize = defaultAnswerQueueSize
+	}
 	s := &Session{
 		SessionConfig:   sessionConfig,
 		quizManagerChan: quizManagerChan,
 		players:         make(map[string]Player),
+		askedQuestions:  make(map[string]int),
+		stopping:        make(chan struct{}),
+		answerQueue:     make(chan answerRequest, sessionConfig.answerQueueSize),
 		ID:              session,
 		publishChannel:  ablyChannel,
 		ctx:             ctx,
 		cancel:          cancel,
+		lastJoin:        time.Now(),
 	}
 
+	go s.processAnswers()
 	return s
 }
 
@@ -69,27 +147,130 @@ func (s *Session) getCurrentQuestion() Question {
 	return s.questions[s.currentQuestion]
 }
 
+// openQuestionIndex returns the index of the question currently accepting answers, if it is the
+// one the answer references. Answers for a question that already closed are late. The caller
+// must hold the lock.
+func (s *Session) openQuestionIndex(answer Answer) (int, error) {
+	questionIndex := answer.CurrentQuestion
+	if answer.QuestionID != "" {
+		index, ok := s.askedQuestions[answer.QuestionID]
+		if !ok {
+			return 0, ErrWrongQuestion
+		}
+		questionIndex = index
+	}
+
+	switch {
+	case questionIndex < s.currentQuestion:
+		return 0, ErrLateAnswer
+	case questionIndex > s.currentQuestion:
+		return 0, ErrWrongQuestion
+	case !s.questionOpen:
+		// Questions only close when moving to the next one, so this one was not asked yet.
+		return 0, ErrNoActiveQuestion
+	case time.Now().After(s.questionDeadline):
+		return 0, ErrLateAnswer
+	}
+	return questionIndex, nil
+}
+
 func (s *Session) getQuestions() []Question {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	return s.questions
 }
 
+// recordAnswer keeps a player's answer to the question it was accepted for, with their updated
+// score. The caller must hold the lock.
+func (s *Session) recordAnswer(player Player, questionIndex, answer int, correct bool) {
+	s.players[player.ID] = player
+	s.answered++
+	now := time.Now()
+	s.answers = append(s.answers, AnswerRecord{
+		PlayerID:       player.ID,
+		QuestionIndex:  questionIndex,
+		Answer:         answer,
+		Correct:        correct,
+		ResponseTimeMs: now.Sub(s.questionStartedAt).Milliseconds(),
+		SubmittedAt:    now,
+	})
+}
+
+// openQuestion starts accepting answers for the current question and returns its event payload.
+func (s *Session) openQuestion() events.QuestionPayload {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	questionID := generateUniqueID()
+	s.askedQuestions[questionID] = s.currentQuestion
+	s.questionStartedAt = time.Now()
+	s.questionDeadline = s.questionStartedAt.Add(s.maxTimePerQuestion)
+	s.questionOpen = true
+	return s.questionPayload(questionID)
+}
+
+// currentQuestionPayload returns the event payload of the question currently open.
+func (s *Session) currentQuestionPayload() events.QuestionPayload {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for questionID, index := range s.askedQuestions {
+		if index == s.currentQuestion {
+			return s.questionPayload(questionID)
+		}
+	}
+	return s.questionPayload("")
+}
+
+// questionPayload builds the event payload of the current question, the caller must hold the lock.
+func (s *Session) questionPayload(questionID string) events.QuestionPayload {
+	question := s.questions[s.currentQuestion]
+	return events.QuestionPayload{
+		QuestionID:      questionID,
+		QuestionIndex:   s.currentQuestion,
+		Question:        question.Question,
+		PossibleAnswers: question.PossibleAnswers,
+		Deadline:        s.questionDeadline.UTC(),
+	}
+}
+
 func (s *Session) moveToNextQuestion() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	s.questionOpen = false
 	s.currentQuestion++
 }
 
-func (s *Session) getPlayers() map[string]Player {
+// resetVotes lets every player answer the next question.
+func (s *Session) resetVotes() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	return s.players
+	for id, player := range s.players {
+		player.hasVoted = false
+		s.players[id] = player
+	}
+	s.answered = 0
 }
-func (s *Session) setPlayer(player Player) {
+
+// uniquePlayerName suffixes a name already taken by another player of the session, e.g.
+// "Alice (2)", so players can tell each other apart. The caller must hold the lock.
+func (s *Session) uniquePlayerName(playerId, name string) string {
+	taken := make(map[string]bool, len(s.players))
+	for _, player := range s.players {
+		if player.ID != playerId {
+			taken[player.Name] = true
+		}
+	}
+	unique := name
+	for suffix := 2; taken[unique]; suffix++ {
+		unique = fmt.Sprintf("%s (%d)", name, suffix)
+	}
+	return unique
+}
+
+// playerName returns the name a player was given when joining, which may have been made unique.
+func (s *Session) playerName(playerId string) string {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.players[player.ID] = player
+	return s.players[playerId].Name
 }
 
 func (s *Session) AddPlayer(player Player) (err error) {
@@ -98,14 +279,24 @@ func (s *Session) AddPlayer(player Player) (err error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	if s.isStopping() {
+		// The session is ending, it has expired or the server is shutting down.
+		return ErrSessionNotFound
+	}
+	if _, ok := s.players[player.ID]; ok {
+		// An account joining again keeps its place and name, rather than taking a second slot.
+		return nil
+	}
 	if len(s.players) < s.maxPlayersPerSession {
-		s.players[player.ID] = Player{ID: player.ID, Name: player.Name, Score: 0}
+		s.players[player.ID] = Player{ID: player.ID, Name: s.uniquePlayerName(player.ID, player.Name), Score: 0}
+		s.lastJoin = time.Now()
 	} else {
-		return errors.New("Cannot add new player max players reached")
+		return ErrSessionFull
 	}
 
 	if len(s.players) == s.maxPlayersPerSession {
 		// Max players reached start the session.
+		s.started = true
 		go s.startQuiz()
 		return nil
 	}
@@ -113,94 +304,242 @@ func (s *Session) AddPlayer(player Player) (err error) {
 	return nil
 }
 
+// Leave removes a player from the session. Leaving a waiting room frees the player's slot,
+// players leaving a game in progress keep their score but can no longer answer.
+func (s *Session) Leave(playerId string) error {
+	fmt.Printf("Player %s leaving session %s\n", playerId, s.ID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	player, ok := s.players[playerId]
+	if !ok || player.left {
+		return ErrPlayerNotFound
+	}
+	if !s.started {
+		delete(s.players, playerId)
+		return nil
+	}
+	player.left = true
+	s.players[playerId] = player
+	s.leftCount++
+	return nil
+}
+
+// AddSpectator lets someone watch the session, spectators do not count toward the player limit.
+func (s *Session) AddSpectator(spectatorId string) {
+	fmt.Printf("Adding spectator %s to session %s\n", spectatorId, s.ID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.spectators++
+}
+
+// publishAnswerCount announces how many players answered the current question. It publishes in
+// the background, so the answer loop carries on with the next answers meanwhile.
+func (s *Session) publishAnswerCount() {
+	if s.publishChannel == nil {
+		return
+	}
+	s.mutex.Lock()
+	payload := events.AnswerCountPayload{Players: len(s.players) - s.leftCount, Answered: s.answered}
+	for questionID, index := range s.askedQuestions {
+		if index == s.currentQuestion {
+			payload.QuestionID = questionID
+		}
+	}
+	s.mutex.Unlock()
+
+	go func() {
+		if err := s.publishChannel.Publish(s.ctx, string(events.AnswerCount), payload); err != nil {
+			fmt.Printf("Error publishing answer count: %v\n", err)
+		}
+	}()
+}
+
+// subscribeEvents returns the events the session publishes from now on, see signedChannel.subscribe.
+// It reports false if the session does not publish signed events.
+func (s *Session) subscribeEvents() (<-chan sealedEvent, func(), bool) {
+	channel, ok := s.publishChannel.(*signedChannel)
+	if !ok {
+		return nil, nil, false
+	}
+	subscription, unsubscribe := channel.subscribe()
+	return subscription, unsubscribe, true
+}
+
+// buildScoreBoard ranks every player with their correct answers and average response time.
+func (s *Session) buildScoreBoard() events.ScoreboardPayload {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	correctAnswers := make(map[string]int)
+	answerCounts := make(map[string]int64)
+	responseTimes := make(map[string]int64)
+	for _, answer := range s.answers {
+		if answer.Correct {
+			correctAnswers[answer.PlayerID]++
+		}
+		answerCounts[answer.PlayerID]++
+		responseTimes[answer.PlayerID] += answer.ResponseTimeMs
+	}
+
+	ranked, ranks := rankPlayers(s.players)
+	scoreBoard := events.ScoreboardPayload{Rankings: make([]events.ScoreboardEntry, 0, len(ranked))}
+	for i, player := range ranked {
+		entry := events.ScoreboardEntry{
+			Rank:           ranks[i],
+			PlayerID:       player.ID,
+			Name:           player.Name,
+			Score:          player.Score,
+			CorrectAnswers: correctAnswers[player.ID],
+		}
+		if answerCounts[player.ID] > 0 {
+			entry.AverageResponseTimeMs = responseTimes[player.ID] / answerCounts[player.ID]
+		}
+		scoreBoard.Rankings = append(scoreBoard.Rankings, entry)
+	}
+	return scoreBoard
+}
+
 func (s *Session) publishScoreBoard() {
 	// Generate and send the score board
-	scoreBoard := make(map[string]int)
-	for _, player := range s.getPlayers() {
-		scoreBoard[player.Name] = player.Score
-	}
+	scoreBoard := s.buildScoreBoard()
 	fmt.Printf("score board %v", scoreBoard)
-	jsonData, err := json.Marshal(scoreBoard)
+	err := s.publishChannel.Publish(s.ctx, string(events.Scoreboard), scoreBoard)
 	if err != nil {
-		fmt.Printf("Error marshalling score board: %v", err)
+		fmt.Printf("Error publishing score board: %v", err)
 	}
 
-	err = s.publishChannel.Publish(s.ctx, "quiz-update", jsonData)
-	if err != nil {
-		fmt.Printf("Error publishing score board: %v", err)
+}
+
+// Submit queues an answer for the session's answer loop and waits for it to be scored, until
+// ctx is done. Rather than holding the caller when the queue is full, it fails with
+// ErrSessionBusy.
+func (s *Session) Submit(ctx context.Context, player Player, answer Answer) error {
+	request := answerRequest{ctx: ctx, player: player, answer: answer, result: make(chan error, 1)}
+	select {
+	case s.answerQueue <- request:
+	default:
+		return ErrSessionBusy
 	}
+	select {
+	case err := <-request.result:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrCommandTimeout, ctx.Err())
+	case <-s.ctx.Done():
+		return ErrSessionNotFound
+	}
+}
 
+// processAnswers scores the queued answers one at a time, so answers of the same player never
+// race, until the session ends. Answers whose caller gave up are dropped. The answer count is
+// published once the queue is empty, rather than after every answer of a burst.
+func (s *Session) processAnswers() {
+	counted := true
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case request := <-s.answerQueue:
+			if request.ctx.Err() == nil {
+				err := s.SubmitAnswer(request.player, request.answer)
+				request.result <- err
+				if err == nil {
+					counted = false
+				}
+			}
+			if !counted && len(s.answerQueue) == 0 {
+				s.publishAnswerCount()
+				counted = true
+			}
+		}
+	}
 }
 
-func (s *Session) SubmitAnswer(player Player, answer int) error {
-	player, exists := s.getPlayers()[player.ID]
-	if !exists {
-		return errors.New("player does not exist")
+// SubmitAnswer scores an answer for the open question. Answers of players go through Submit,
+// so that only the answer loop calls it. The answer is checked and recorded under one lock, so
+// the question cannot move on in between.
+func (s *Session) SubmitAnswer(player Player, answer Answer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	player, exists := s.players[player.ID]
+	if !exists || player.left {
+		return ErrPlayerNotFound
 	}
 	if player.hasVoted {
-		return errors.New("player has already voted")
+		return ErrAlreadyAnswered
+	}
+	questionIndex, err := s.openQuestionIndex(answer)
+	if err != nil {
+		return err
+	}
+	question := s.questions[questionIndex]
+	if answer.AnswerChoice < 0 || answer.AnswerChoice >= len(question.PossibleAnswers) {
+		return ErrAnswerOutOfRange
 	}
 	// Check if the submitted answer index is correct
-	if answer == s.getCurrentQuestion().CorrectAnswer {
+	correct := answer.AnswerChoice == question.CorrectAnswer
+	if correct {
 		// Could add a return to the user, so they know if they were correct or not
 		player.Score++
+		player.Streak++
+	} else {
+		player.Streak = 0
 	}
 	player.hasVoted = true
-	s.setPlayer(player)
+	s.recordAnswer(player, questionIndex, answer.AnswerChoice, correct)
 	return nil
 }
 
 func (s *Session) publishQuestion() error {
-	// Set all player hasVoted to false
-	for _, player := range s.getPlayers() {
-		player.hasVoted = false
-		s.setPlayer(player)
-	}
-	// Publish the next question, send only the question and possible answers
-	type QuestionPayload struct {
-		Question        string   `json:"question"`
-		PossibleAnswers []string `json:"possibleAnswers"`
-	}
-	currentQuestion := s.getCurrentQuestion()
-
-	data := QuestionPayload{
-		Question:        currentQuestion.Question,
-		PossibleAnswers: currentQuestion.PossibleAnswers,
-	}
-	fmt.Printf("current question %v\n", currentQuestion)
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return err
-	}
-	err = s.publishChannel.Publish(s.ctx, "new_question", jsonData)
-	if err != nil {
-		return err
-	}
-	return nil
+	s.resetVotes()
+	// Publish the next question, send only the question and possible answers. Answers are
+	// accepted from here, so the ones arriving with the event are not rejected.
+	data := s.openQuestion()
+	fmt.Printf("current question %v\n", data.Question)
+	return s.publishChannel.Publish(s.ctx, string(events.NewQuestion), data)
 }
 
 func (s *Session) startQuiz() {
-	responseChan := make(chan SessionManagerResponse)
 	s.quizManagerChan <- SessionManagerCommand{
-		CommandType:  MoveSessionToInProgress,
-		SessionId:    s.ID,
-		ResponseChan: responseChan,
-	}
-	response := <-responseChan
-	if response.Error != nil {
-		fmt.Printf("error moving session to in progress: %v", response.Error)
-		s.endSession()
+		CommandType: MoveSessionToInProgress,
+		SessionId:   s.ID,
+	}
+
+	if !s.countdown() {
 		return
 	}
+	s.runQuestions()
+}
 
-	time.Sleep(500 * time.Millisecond)
-	err := s.publishChannel.Publish(s.ctx, "quiz-update", fmt.Sprintf("Quiz starting in 3 seconds"))
+// countdown announces the quiz is starting and waits for it to start, it returns false if
+// the session ended meanwhile.
+func (s *Session) countdown() bool {
+	if !s.wait(500 * time.Millisecond) {
+		s.endSession(s.stopMessage)
+		return false
+	}
+	err := s.publishChannel.Publish(s.ctx, string(events.QuizStarting), events.QuizStartingPayload{
+		StartsInSeconds: 3,
+		Message:         "Quiz starting in 3 seconds",
+	})
 	if err != nil {
 		fmt.Printf("Error publishing quiz-starting message: %v", err)
-		s.endSession()
+		s.endSession(endedMessage)
+		return false
 	}
 
-	time.Sleep(3 * time.Second)
+	if !s.wait(3 * time.Second) {
+		s.endSession(s.stopMessage)
+		return false
+	}
+	s.mutex.Lock()
+	s.startedAt = time.Now()
+	s.mutex.Unlock()
+	return true
+}
+
+// runQuestions asks every remaining question, then publishes the scoreboard and ends the session.
+func (s *Session) runQuestions() {
 	for {
 		if s.getCurrentQuestionCounter() >= len(s.getQuestions()) {
 			break
@@ -209,34 +548,190 @@ func (s *Session) startQuiz() {
 		err := s.publishQuestion()
 		if err != nil {
 			fmt.Printf("Error publishing question: %v", err)
-			s.endSession()
+			s.endSession(endedMessage)
 			return
 		}
+		s.saveSnapshot()
 		// Wait for the duration of a question
-		<-time.After(s.maxTimePerQuestion)
-
-		// Move to the next question
-		s.moveToNextQuestion()
+		if !s.closeQuestionAfter(s.maxTimePerQuestion) {
+			return
+		}
 	}
 	s.publishScoreBoard()
-	s.endSession()
+	s.saveResult()
+	s.endSession(endedMessage)
+}
+
+// closeQuestionAfter waits for the current question's time to run out, then moves to the next
+// question and shows how the question changed the standings. It returns false if the session
+// was stopped meanwhile.
+func (s *Session) closeQuestionAfter(remaining time.Duration) bool {
+	if !s.wait(remaining) {
+		s.endSession(s.stopMessage)
+		return false
+	}
+	questionIndex := s.getCurrentQuestionCounter()
+	s.moveToNextQuestion()
+	s.publishStandings(questionIndex)
+	s.saveSnapshot()
+	return true
 }
 
-func (s *Session) endSession() {
-	err := s.publishChannel.Publish(s.ctx, "quiz-end", fmt.Sprintf("thank you for playing"))
+// wait pauses the game loop, it returns false if the session was stopped in the meantime.
+func (s *Session) wait(duration time.Duration) bool {
+	select {
+	case <-time.After(duration):
+		return true
+	case <-s.stopping:
+		return false
+	}
+}
+
+// isStopping reports whether Stop was called.
+func (s *Session) isStopping() bool {
+	select {
+	case <-s.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// isOpen reports whether players can still join the session: it has neither started nor begun
+// stopping. A full session is started before the manager moves it out of its waiting rooms.
+func (s *Session) isOpen() bool {
+	if s.isStopping() {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return !s.started
+}
+
+// Messages of the quiz-end event of sessions that expired.
+const (
+	idleMessage     = "no other players joined in time"
+	lifetimeMessage = "the game ran for too long"
+)
+
+// runExpiry stops the session if it waits for players with nobody joining for idleTimeout,
+// freeing its slot, or once it has run for maxLifetime since it was created or restored.
+// Either way its players are told why in the quiz-end event.
+func (s *Session) runExpiry() {
+	var lifetime <-chan time.Time
+	if s.maxLifetime > 0 {
+		timer := time.NewTimer(s.maxLifetime)
+		defer timer.Stop()
+		lifetime = timer.C
+	}
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if s.idleTimeout > 0 {
+		idleTimer = time.NewTimer(s.idleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-lifetime:
+			if s.stopIf(lifetimeMessage, func() bool { return true }) {
+				fmt.Printf("Session %s reached its maximum lifetime\n", s.ID)
+			}
+			return
+		case <-idle:
+			var started bool
+			var idleFor time.Duration
+			expired := s.stopIf(idleMessage, func() bool {
+				started, idleFor = s.started, time.Since(s.lastJoin)
+				return !started && idleFor >= s.idleTimeout
+			})
+			switch {
+			case expired:
+				fmt.Printf("Waiting room %s expired, nobody joined for %s\n", s.ID, idleFor.Round(time.Second))
+				return
+			case started:
+				// Games in progress are never idle, only their lifetime is limited.
+				idle = nil
+			default:
+				idleTimer.Reset(s.idleTimeout - idleFor)
+			}
+		}
+	}
+}
+
+// Stop ends the session early, telling players why in the quiz-end event. A running game
+// stops at its next step, a session still waiting for players ends right away. Stop must not
+// be called from the session manager's goroutine, ending a session sends it a command.
+func (s *Session) Stop(message string) {
+	s.stopIf(message, func() bool { return true })
+}
+
+// stopIf stops the session like Stop if it is neither stopping nor ended and canStop returns
+// true. canStop is called with the mutex held, and the session starts stopping before it is
+// released, so no player can start the game and no game can end in between. It reports whether
+// the session was stopped.
+func (s *Session) stopIf(message string, canStop func() bool) bool {
+	s.mutex.Lock()
+	if s.finishing || s.isStopping() || !canStop() {
+		s.mutex.Unlock()
+		return false
+	}
+	s.stopMessage = message
+	close(s.stopping)
+	started := s.started
+	s.mutex.Unlock()
+
+	if !started {
+		s.endSession(message)
+	}
+	return true
+}
+
+// buildResult collects the final state of the session into a SessionResult.
+func (s *Session) buildResult() SessionResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := SessionResult{
+		SessionID: s.ID,
+		StartedAt: s.startedAt,
+		EndedAt:   time.Now(),
+		Questions: s.questions,
+		Players:   make([]PlayerResult, 0, len(s.players)),
+		Answers:   append([]AnswerRecord(nil), s.answers...),
+	}
+	for _, player := range s.players {
+		result.Players = append(result.Players, PlayerResult{ID: player.ID, Name: player.Name, Score: player.Score})
+	}
+	return result
+}
+
+func (s *Session) saveResult() {
+	if s.resultsStore == nil {
+		return
+	}
+	if err := s.resultsStore.SaveSessionResult(s.buildResult()); err != nil {
+		fmt.Printf("Error saving session result: %v\n", err)
+	}
+}
+
+// endedMessage is the quiz-end message of sessions that were not stopped early.
+const endedMessage = "thank you for playing"
+
+func (s *Session) endSession(message string) {
+	s.mutex.Lock()
+	s.finishing = true
+	s.mutex.Unlock()
+	err := s.publishChannel.Publish(s.ctx, string(events.QuizEnd), events.QuizEndPayload{Message: message})
 	if err != nil {
 		fmt.Printf("Error publishing end quiz message: %v", err)
 	}
-	responseChan := make(chan SessionManagerResponse)
 	s.quizManagerChan <- SessionManagerCommand{
-		CommandType:  EndSession,
-		SessionId:    s.ID,
-		ResponseChan: responseChan,
-	}
-	response := <-responseChan
-	if response.Error != nil {
-		panic(fmt.Errorf("error ending session: %v", response.Error))
+		CommandType: EndSession,
+		SessionId:   s.ID,
 	}
+	s.deleteSnapshot()
 	s.cancel()
-
 }
@@ -2,10 +2,13 @@ package quiz_server // change to your actual package name
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"sync/atomic"
 	"testing"
+	"the-quiz-game/pkg/events"
+	"time"
 )
 
 // MockRealtimeChannel to make it easier to test the publishScoreBoard function.
@@ -19,6 +22,13 @@ func (m *MockRealtimeChannel) Publish(ctx context.Context, name string, data int
 	return args.Error(0)
 }
 
+// discardChannel drops every event, for benchmarks where a mock would dominate the cost.
+type discardChannel struct{}
+
+func (discardChannel) Publish(ctx context.Context, name string, data interface{}) error {
+	return nil
+}
+
 // Basic unit test for the publishScoreBoard build the correct scoreboard function.
 func TestSession_publishScoreBoard(t *testing.T) {
 	// Create an instance of our test object.
@@ -32,28 +42,205 @@ func TestSession_publishScoreBoard(t *testing.T) {
 
 	// Simulate some players in the session.
 	session.players = map[string]Player{
-		"player1": {Name: "Alice", ID: "1", Score: 10, hasVoted: false},
-		"player2": {Name: "Bob", ID: "2", Score: 20, hasVoted: true},
+		"player1": {Name: "Alice", ID: "1", Score: 1, hasVoted: false},
+		"player2": {Name: "Bob", ID: "2", Score: 2, hasVoted: true},
+		"player3": {Name: "Bob", ID: "3", Score: 1, hasVoted: true},
 	}
-
-	expectedScoreBoard := make(map[string]int)
-	for _, player := range session.players {
-		expectedScoreBoard[player.Name] = player.Score
+	session.answers = []AnswerRecord{
+		{PlayerID: "1", Correct: true, ResponseTimeMs: 1000},
+		{PlayerID: "1", Correct: false, ResponseTimeMs: 2000},
+		{PlayerID: "2", Correct: true, ResponseTimeMs: 500},
+		{PlayerID: "2", Correct: true, ResponseTimeMs: 700},
+		{PlayerID: "3", Correct: true, ResponseTimeMs: 300},
 	}
 
-	expectedJSON, err := json.Marshal(expectedScoreBoard)
-	require.NoError(t, err)
+	// Players are ordered by score, players with the same score share a rank.
+	expectedScoreBoard := events.ScoreboardPayload{Rankings: []events.ScoreboardEntry{
+		{Rank: 1, PlayerID: "2", Name: "Bob", Score: 2, CorrectAnswers: 2, AverageResponseTimeMs: 600},
+		{Rank: 2, PlayerID: "1", Name: "Alice", Score: 1, CorrectAnswers: 1, AverageResponseTimeMs: 1500},
+		{Rank: 2, PlayerID: "3", Name: "Bob", Score: 1, CorrectAnswers: 1, AverageResponseTimeMs: 300},
+	}}
 
-	mockChannel.On("Publish", ctx, "quiz-update", mock.MatchedBy(func(data interface{}) bool {
-		// Compare the passed data with the expected JSON.
-		actualJSON, ok := data.([]byte)
-		if !ok {
-			return false
-		}
-		return string(actualJSON) == string(expectedJSON)
-	})).Return(nil)
+	mockChannel.On("Publish", ctx, string(events.Scoreboard), expectedScoreBoard).Return(nil)
 
 	session.publishScoreBoard()
 
 	mockChannel.AssertExpectations(t)
 }
+
+// Answers are only accepted for the open question and within its possible answers.
+func TestSession_SubmitAnswerValidation(t *testing.T) {
+	session := NewSession("testSession", SessionConfig{
+		maxTimePerQuestion: time.Minute,
+		questions: []Question{
+			{Question: "first", PossibleAnswers: []string{"a", "b"}, CorrectAnswer: 1},
+			{Question: "second", PossibleAnswers: []string{"a", "b", "c"}, CorrectAnswer: 2},
+		},
+	}, nil, nil, nil, context.Background())
+	session.players = map[string]Player{"1": {Name: "Alice", ID: "1"}}
+	player := Player{ID: "1"}
+
+	require.ErrorIs(t, session.SubmitAnswer(player, Answer{AnswerChoice: 1, CurrentQuestion: 0}), ErrNoActiveQuestion)
+
+	first := session.openQuestion()
+	require.Equal(t, 0, first.QuestionIndex)
+	require.ErrorIs(t, session.SubmitAnswer(player, Answer{AnswerChoice: 1, CurrentQuestion: 1}), ErrWrongQuestion)
+	require.ErrorIs(t, session.SubmitAnswer(player, Answer{AnswerChoice: 1, QuestionID: "unknown"}), ErrWrongQuestion)
+	require.ErrorIs(t, session.SubmitAnswer(player, Answer{AnswerChoice: 2, QuestionID: first.QuestionID}), ErrAnswerOutOfRange)
+	require.ErrorIs(t, session.SubmitAnswer(player, Answer{AnswerChoice: -1, QuestionID: first.QuestionID}), ErrAnswerOutOfRange)
+	require.NoError(t, session.SubmitAnswer(player, Answer{AnswerChoice: 1, QuestionID: first.QuestionID}))
+	require.Equal(t, 1, session.players["1"].Score)
+
+	// An answer for the previous question arriving after the move is late, not scored against the next one.
+	session.moveToNextQuestion()
+	session.players["1"] = Player{Name: "Alice", ID: "1", Score: 1}
+	require.ErrorIs(t, session.SubmitAnswer(player, Answer{AnswerChoice: 1, QuestionID: first.QuestionID}), ErrLateAnswer)
+	second := session.openQuestion()
+	require.NotEqual(t, first.QuestionID, second.QuestionID)
+	require.ErrorIs(t, session.SubmitAnswer(player, Answer{AnswerChoice: 2, QuestionID: first.QuestionID}), ErrLateAnswer)
+
+	// Answers after the deadline are late even before the next question.
+	session.questionDeadline = time.Now().Add(-time.Second)
+	require.ErrorIs(t, session.SubmitAnswer(player, Answer{AnswerChoice: 2, QuestionID: second.QuestionID}), ErrLateAnswer)
+
+	// Once the last question closed there is nothing to answer.
+	session.moveToNextQuestion()
+	require.ErrorIs(t, session.SubmitAnswer(player, Answer{AnswerChoice: 0, QuestionID: second.QuestionID}), ErrLateAnswer)
+	require.ErrorIs(t, session.SubmitAnswer(player, Answer{AnswerChoice: 0, CurrentQuestion: 2}), ErrNoActiveQuestion)
+}
+
+// Spectators never take one of the player slots.
+func TestSession_AddSpectator(t *testing.T) {
+	session := NewSession("testSession", SessionConfig{maxPlayersPerSession: 2}, nil, nil, nil, context.Background())
+	session.AddSpectator("spectator1")
+	session.AddSpectator("spectator2")
+
+	require.NoError(t, session.AddPlayer(Player{ID: "1", Name: "Alice"}))
+	require.Len(t, session.players, 1)
+	require.Equal(t, 2, session.spectators)
+}
+
+// Players joining with a name already taken in the session get a suffix.
+func TestSession_AddPlayerDuplicateName(t *testing.T) {
+	session := NewSession("testSession", SessionConfig{maxPlayersPerSession: 4}, nil, nil, nil, context.Background())
+
+	require.NoError(t, session.AddPlayer(Player{ID: "1", Name: "Alice"}))
+	require.NoError(t, session.AddPlayer(Player{ID: "2", Name: "Alice"}))
+	require.NoError(t, session.AddPlayer(Player{ID: "3", Name: "Alice"}))
+	require.Equal(t, "Alice", session.playerName("1"))
+	require.Equal(t, "Alice (2)", session.playerName("2"))
+	require.Equal(t, "Alice (3)", session.playerName("3"))
+
+	// An account joining a room it is already in keeps its slot and name.
+	require.NoError(t, session.AddPlayer(Player{ID: "1", Name: "Alice"}))
+	require.Len(t, session.players, 3)
+	require.Equal(t, "Alice", session.playerName("1"))
+}
+
+// Answers beyond the queue size are refused rather than holding the handler.
+func TestSession_SubmitQueueFull(t *testing.T) {
+	session := NewSession("testSession", SessionConfig{answerQueueSize: 1}, nil, nil, nil, context.Background())
+	player := Player{ID: "1"}
+
+	// Holding the session lock blocks the answer loop on the first answer it takes.
+	session.mutex.Lock()
+	go session.Submit(context.Background(), player, Answer{})
+	require.Eventually(t, func() bool { return len(session.answerQueue) == 0 }, time.Second, time.Millisecond)
+	go session.Submit(context.Background(), player, Answer{})
+	require.Eventually(t, func() bool { return len(session.answerQueue) == 1 }, time.Second, time.Millisecond)
+
+	require.ErrorIs(t, session.Submit(context.Background(), player, Answer{}), ErrSessionBusy)
+	session.mutex.Unlock()
+}
+
+// Waiting rooms nobody joins must end, telling their players why and releasing their slot.
+func TestSession_ExpiresIdleWaitingRoom(t *testing.T) {
+	mockChannel := new(MockRealtimeChannel)
+	mockChannel.On("Publish", mock.Anything, string(events.QuizEnd), events.QuizEndPayload{Message: idleMessage}).Return(nil)
+	managerChan := make(chan SessionManagerCommand, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	session := NewSession("waiting", SessionConfig{maxPlayersPerSession: 2, idleTimeout: 20 * time.Millisecond}, managerChan, mockChannel, cancel, ctx)
+	require.NoError(t, session.AddPlayer(Player{ID: "1", Name: "Alice"}))
+	go session.runExpiry()
+
+	select {
+	case cmd := <-managerChan:
+		require.Equal(t, EndSession, cmd.CommandType)
+		require.Equal(t, "waiting", cmd.SessionId)
+	case <-time.After(time.Second):
+		t.Fatal("waiting room did not expire")
+	}
+	mockChannel.AssertExpectations(t)
+	require.ErrorIs(t, session.AddPlayer(Player{ID: "2", Name: "Bob"}), ErrSessionNotFound)
+}
+
+// Games running for longer than the maximum lifetime must be stopped.
+func TestSession_MaxLifetime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := NewSession("running", SessionConfig{idleTimeout: time.Millisecond, maxLifetime: 20 * time.Millisecond}, nil, nil, cancel, ctx)
+	session.started = true
+	go session.runExpiry()
+
+	require.Eventually(t, session.isStopping, time.Second, time.Millisecond)
+	require.Equal(t, lifetimeMessage, session.stopMessage)
+}
+
+// A session that already ended must not be stopped again when its lifetime runs out.
+func TestSession_MaxLifetimeAfterEnd(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := NewSession("ended", SessionConfig{maxLifetime: time.Millisecond}, nil, nil, cancel, ctx)
+	session.started = true
+	session.finishing = true
+
+	expired := make(chan struct{})
+	go func() {
+		session.runExpiry()
+		close(expired)
+	}()
+	select {
+	case <-expired:
+	case <-time.After(time.Second):
+		t.Fatal("lifetime did not run out")
+	}
+	require.False(t, session.isStopping())
+	require.Empty(t, session.stopMessage)
+}
+
+// newBenchmarkSession creates a session with the given number of players and an open question.
+func newBenchmarkSession(id string, players int) *Session {
+	session := NewSession(id, SessionConfig{
+		maxTimePerQuestion: time.Hour,
+		questions:          []Question{{Question: "first", PossibleAnswers: []string{"a", "b"}, CorrectAnswer: 1}},
+	}, nil, discardChannel{}, nil, context.Background())
+	for i := 0; i < players; i++ {
+		id := fmt.Sprint(i)
+		session.players[id] = Player{ID: id, Name: id}
+	}
+	session.openQuestion()
+	return session
+}
+
+// Every player of a large session answers the open question at once.
+func BenchmarkSession_Submit(b *testing.B) {
+	session := newBenchmarkSession("testSession", b.N)
+	var next int64 = -1
+	var scored int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			player := Player{ID: fmt.Sprint(atomic.AddInt64(&next, 1))}
+			switch err := session.Submit(context.Background(), player, Answer{AnswerChoice: 1}); err {
+			case nil:
+				atomic.AddInt64(&scored, 1)
+			case ErrSessionBusy:
+				// Refused answers are not scored, so they do not count toward the rate.
+			default:
+				b.Fatal(err)
+			}
+		}
+	})
+	b.ReportMetric(float64(scored)/b.Elapsed().Seconds(), "answers/s")
+	b.ReportMetric(float64(int64(b.N)-scored)/float64(b.N), "refused/op")
+}
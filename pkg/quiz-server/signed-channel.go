@@ -0,0 +1,91 @@
+package quiz_server
+
+import (
+	"context"
+	"sync"
+	"the-quiz-game/pkg/events"
+	"the-quiz-game/pkg/signing"
+)
+
+// signedChannel wraps a RealtimeChannel so every published payload is wrapped in a numbered
+// event envelope and signed, letting clients drop events that did not come from the server.
+type signedChannel struct {
+	channel   RealtimeChannel
+	signer    *signing.Signer
+	sessionId string
+	mutex     sync.Mutex
+	sequence  uint64
+	// subscribers receive every event published after they subscribed, see subscribe.
+	subscribers map[chan sealedEvent]struct{}
+}
+
+// sealedEvent is an event as published on the realtime channel, its name and signed envelope.
+type sealedEvent struct {
+	name string
+	data string
+}
+
+// subscriberQueueSize is how many events a subscriber can fall behind before it is dropped.
+const subscriberQueueSize = 64
+
+func newSignedChannel(channel RealtimeChannel, signer *signing.Signer, sessionId string) *signedChannel {
+	return &signedChannel{
+		channel:   channel,
+		signer:    signer,
+		sessionId: sessionId,
+	}
+}
+
+// Publish wraps data, one of the payloads in the events package, in an envelope of the
+// event type name and publishes the signed envelope as a JSON string.
+func (c *signedChannel) Publish(ctx context.Context, name string, data interface{}) error {
+	// Hold the lock while publishing so events leave in sequence order.
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	envelope, err := events.NewEnvelope(events.Type(name), c.sessionId, c.sequence+1, data)
+	if err != nil {
+		return err
+	}
+	sealed, err := events.Seal(c.signer, envelope)
+	if err != nil {
+		return err
+	}
+	c.sequence++
+	for subscriber := range c.subscribers {
+		select {
+		case subscriber <- sealedEvent{name: name, data: sealed}:
+		default:
+			// Publishing never waits for a subscriber, one that fell behind is dropped.
+			delete(c.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+	return c.channel.Publish(ctx, name, sealed)
+}
+
+// subscribe returns a channel receiving the events published from now on, which is closed if
+// the subscriber falls behind, and a function to unsubscribe.
+func (c *signedChannel) subscribe() (<-chan sealedEvent, func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	subscriber := make(chan sealedEvent, subscriberQueueSize)
+	if c.subscribers == nil {
+		c.subscribers = make(map[chan sealedEvent]struct{})
+	}
+	c.subscribers[subscriber] = struct{}{}
+	return subscriber, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if _, ok := c.subscribers[subscriber]; ok {
+			delete(c.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// Sequence returns the sequence number of the last event published.
+func (c *signedChannel) Sequence() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.sequence
+}
@@ -0,0 +1,294 @@
+package quiz_server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"the-quiz-game/pkg/events"
+	"time"
+)
+
+// resumeSequenceGap is added to the event sequence of restored sessions, events published after
+// their last snapshot used the numbers in between and clients only accept increasing numbers.
+const resumeSequenceGap = 1000
+
+// resumedMessage is the message of the resumed event published by restored sessions.
+const resumedMessage = "the game has resumed after a server restart"
+
+type SessionState string
+
+const (
+	SessionWaiting    SessionState = "waiting"
+	SessionInProgress SessionState = "in-progress"
+)
+
+// PlayerSnapshot is the state of a player in a session snapshot.
+type PlayerSnapshot struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Score    int    `json:"score"`
+	Streak   int    `json:"streak"`
+	HasVoted bool   `json:"hasVoted"`
+	Left     bool   `json:"left,omitempty"`
+}
+
+// SessionSnapshot is everything needed to restore a session and resume its game.
+type SessionSnapshot struct {
+	SessionID       string           `json:"sessionId"`
+	State           SessionState     `json:"state"`
+	Questions       []Question       `json:"questions"`
+	Players         []PlayerSnapshot `json:"players"`
+	CurrentQuestion int              `json:"currentQuestion"`
+	QuestionOpen    bool             `json:"questionOpen"`
+	// QuestionRemainingMs is the time the open question had left when the snapshot was taken.
+	QuestionRemainingMs int64          `json:"questionRemainingMs"`
+	AskedQuestions      map[string]int `json:"askedQuestions"`
+	Answers             []AnswerRecord `json:"answers"`
+	LastScores          map[string]int `json:"lastScores"`
+	LastRanks           map[string]int `json:"lastRanks"`
+	StartedAt           time.Time      `json:"startedAt"`
+	// Sequence is the sequence number of the last event published on the session channel.
+	Sequence uint64    `json:"sequence"`
+	SavedAt  time.Time `json:"savedAt"`
+}
+
+type SnapshotStore interface {
+	SaveSnapshot(snapshot SessionSnapshot) error
+	DeleteSnapshot(sessionId string) error
+	ListSnapshots() ([]SessionSnapshot, error)
+}
+
+// FileSnapshotStore keeps the snapshot of each session in its own JSON file in a directory.
+type FileSnapshotStore struct {
+	dir string
+}
+
+func NewFileSnapshotStore(dir string) (*FileSnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	return &FileSnapshotStore{dir: dir}, nil
+}
+
+func (f *FileSnapshotStore) path(sessionId string) (string, error) {
+	if sessionId == "" || strings.ContainsAny(sessionId, `/\`) {
+		return "", fmt.Errorf("invalid session ID %q", sessionId)
+	}
+	return filepath.Join(f.dir, sessionId+".json"), nil
+}
+
+func (f *FileSnapshotStore) SaveSnapshot(snapshot SessionSnapshot) error {
+	path, err := f.path(snapshot.SessionID)
+	if err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash never leaves a half written snapshot behind.
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, jsonData, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (f *FileSnapshotStore) DeleteSnapshot(sessionId string) error {
+	path, err := f.path(sessionId)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (f *FileSnapshotStore) ListSnapshots() ([]SessionSnapshot, error) {
+	files, err := filepath.Glob(filepath.Join(f.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]SessionSnapshot, 0, len(files))
+	for _, file := range files {
+		fileContent, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var snapshot SessionSnapshot
+		if err := json.Unmarshal(fileContent, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot file %s: %w", file, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// snapshot captures the state of the session.
+func (s *Session) snapshot() SessionSnapshot {
+	s.mutex.Lock()
+	snapshot := SessionSnapshot{
+		SessionID:       s.ID,
+		State:           SessionWaiting,
+		Questions:       s.questions,
+		Players:         make([]PlayerSnapshot, 0, len(s.players)),
+		CurrentQuestion: s.currentQuestion,
+		QuestionOpen:    s.questionOpen,
+		AskedQuestions:  make(map[string]int, len(s.askedQuestions)),
+		Answers:         append([]AnswerRecord(nil), s.answers...),
+		LastScores:      make(map[string]int, len(s.lastScores)),
+		LastRanks:       make(map[string]int, len(s.lastRanks)),
+		StartedAt:       s.startedAt,
+		SavedAt:         time.Now(),
+	}
+	if s.started {
+		snapshot.State = SessionInProgress
+	}
+	if s.questionOpen {
+		if remaining := time.Until(s.questionDeadline); remaining > 0 {
+			snapshot.QuestionRemainingMs = remaining.Milliseconds()
+		}
+	}
+	for _, player := range s.players {
+		snapshot.Players = append(snapshot.Players, PlayerSnapshot{
+			ID:       player.ID,
+			Name:     player.Name,
+			Score:    player.Score,
+			Streak:   player.Streak,
+			HasVoted: player.hasVoted,
+			Left:     player.left,
+		})
+	}
+	for questionID, index := range s.askedQuestions {
+		snapshot.AskedQuestions[questionID] = index
+	}
+	for id, score := range s.lastScores {
+		snapshot.LastScores[id] = score
+	}
+	for id, rank := range s.lastRanks {
+		snapshot.LastRanks[id] = rank
+	}
+	s.mutex.Unlock()
+
+	if channel, ok := s.publishChannel.(*signedChannel); ok {
+		snapshot.Sequence = channel.Sequence()
+	}
+	return snapshot
+}
+
+// restoreSession recreates a session from its snapshot, resume continues its game.
+func restoreSession(snapshot SessionSnapshot, sessionConfig SessionConfig, quizManagerChan chan<- SessionManagerCommand, channel RealtimeChannel, cancel context.CancelFunc, ctx context.Context) *Session {
+	s := NewSession(snapshot.SessionID, sessionConfig, quizManagerChan, channel, cancel, ctx)
+	remaining := time.Duration(snapshot.QuestionRemainingMs) * time.Millisecond
+	s.started = snapshot.State == SessionInProgress
+	s.currentQuestion = snapshot.CurrentQuestion
+	s.questionOpen = snapshot.QuestionOpen
+	s.questionDeadline = time.Now().Add(remaining)
+	s.questionStartedAt = s.questionDeadline.Add(-s.maxTimePerQuestion)
+	s.answers = snapshot.Answers
+	s.lastScores = snapshot.LastScores
+	s.lastRanks = snapshot.LastRanks
+	s.startedAt = snapshot.StartedAt
+	for questionID, index := range snapshot.AskedQuestions {
+		s.askedQuestions[questionID] = index
+	}
+	for _, player := range snapshot.Players {
+		s.players[player.ID] = Player{
+			ID:       player.ID,
+			Name:     player.Name,
+			Score:    player.Score,
+			Streak:   player.Streak,
+			hasVoted: player.HasVoted,
+			left:     player.Left,
+		}
+		if player.HasVoted {
+			s.answered++
+		}
+		if player.Left {
+			s.leftCount++
+		}
+	}
+	return s
+}
+
+// resume continues the game of a restored session, after telling its players it resumed.
+// An open question is asked again with the time it had left, answers given before the restart
+// still count. Waiting rooms carry on waiting for players.
+func (s *Session) resume() {
+	err := s.publishChannel.Publish(s.ctx, string(events.Resumed), events.ResumedPayload{Message: resumedMessage})
+	if err != nil {
+		fmt.Printf("Error publishing resumed message: %v\n", err)
+	}
+
+	s.mutex.Lock()
+	started := s.started
+	countedDown := !s.startedAt.IsZero()
+	questionOpen := s.questionOpen
+	remaining := time.Until(s.questionDeadline)
+	s.mutex.Unlock()
+
+	if !started {
+		return
+	}
+	if !countedDown && !s.countdown() {
+		return
+	}
+	if questionOpen {
+		if err := s.publishChannel.Publish(s.ctx, string(events.NewQuestion), s.currentQuestionPayload()); err != nil {
+			fmt.Printf("Error publishing question: %v\n", err)
+		}
+		if !s.closeQuestionAfter(remaining) {
+			return
+		}
+	}
+	s.runQuestions()
+}
+
+// runSnapshots saves a snapshot of the session every interval until the session ends.
+func (s *Session) runSnapshots(interval time.Duration) {
+	if s.snapshotStore == nil || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.saveSnapshot()
+		}
+	}
+}
+
+func (s *Session) saveSnapshot() {
+	if s.snapshotStore == nil {
+		return
+	}
+	s.snapshotMutex.Lock()
+	defer s.snapshotMutex.Unlock()
+	if s.ended {
+		return
+	}
+	if err := s.snapshotStore.SaveSnapshot(s.snapshot()); err != nil {
+		fmt.Printf("Error saving snapshot of session %s: %v\n", s.ID, err)
+	}
+}
+
+// deleteSnapshot removes the snapshot of an ended session, so it is not restored.
+func (s *Session) deleteSnapshot() {
+	s.snapshotMutex.Lock()
+	defer s.snapshotMutex.Unlock()
+	s.ended = true
+	if s.snapshotStore == nil {
+		return
+	}
+	if err := s.snapshotStore.DeleteSnapshot(s.ID); err != nil {
+		fmt.Printf("Error deleting snapshot of session %s: %v\n", s.ID, err)
+	}
+}
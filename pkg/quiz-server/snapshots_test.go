@@ -0,0 +1,60 @@
+package quiz_server
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// A session restored from its snapshot must carry on where it was, with an open question
+// keeping its ID and the time it had left.
+func TestSession_SnapshotRestore(t *testing.T) {
+	store, err := NewFileSnapshotStore(t.TempDir())
+	require.NoError(t, err)
+
+	config := SessionConfig{
+		maxPlayersPerSession: 2,
+		maxTimePerQuestion:   time.Minute,
+		questions: []Question{
+			{Question: "first", PossibleAnswers: []string{"a", "b"}, CorrectAnswer: 1},
+			{Question: "second", PossibleAnswers: []string{"a", "b"}, CorrectAnswer: 0},
+		},
+		snapshotStore: store,
+	}
+	session := NewSession("session1", config, nil, nil, nil, context.Background())
+	session.started = true
+	session.players = map[string]Player{
+		"1": {ID: "1", Name: "Alice"},
+		"2": {ID: "2", Name: "Bob"},
+	}
+	question := session.openQuestion()
+	require.NoError(t, session.SubmitAnswer(Player{ID: "1"}, Answer{AnswerChoice: 1, QuestionID: question.QuestionID}))
+	session.saveSnapshot()
+
+	snapshots, err := store.ListSnapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	require.Equal(t, SessionInProgress, snapshots[0].State)
+
+	restored := restoreSession(snapshots[0], config, nil, nil, nil, context.Background())
+	require.Equal(t, session.players, restored.players)
+	require.Equal(t, session.answers[0].PlayerID, restored.answers[0].PlayerID)
+	require.True(t, restored.started)
+	require.WithinDuration(t, session.questionDeadline, restored.questionDeadline, time.Second)
+	payload := restored.currentQuestionPayload()
+	require.WithinDuration(t, question.Deadline, payload.Deadline, time.Second)
+	payload.Deadline = question.Deadline
+	require.Equal(t, question, payload)
+
+	// The player who already answered cannot answer again, the other one still can.
+	require.Error(t, restored.SubmitAnswer(Player{ID: "1"}, Answer{AnswerChoice: 1, QuestionID: question.QuestionID}))
+	require.NoError(t, restored.SubmitAnswer(Player{ID: "2"}, Answer{AnswerChoice: 1, QuestionID: question.QuestionID}))
+
+	// Ended sessions are not restored, and are no longer snapshotted.
+	session.deleteSnapshot()
+	session.saveSnapshot()
+	snapshots, err = store.ListSnapshots()
+	require.NoError(t, err)
+	require.Empty(t, snapshots)
+}
@@ -0,0 +1,92 @@
+package quiz_server
+
+import (
+	"fmt"
+	"sort"
+	"the-quiz-game/pkg/events"
+)
+
+// rankPlayers orders players by score, highest first, then by name and ID so the order is stable.
+// Players with the same score share a rank, the next rank skips the tied places (1, 1, 3).
+func rankPlayers(players map[string]Player) ([]Player, []int) {
+	ranked := make([]Player, 0, len(players))
+	for _, player := range players {
+		ranked = append(ranked, player)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		if ranked[i].Name != ranked[j].Name {
+			return ranked[i].Name < ranked[j].Name
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+
+	ranks := make([]int, len(ranked))
+	for i := range ranked {
+		ranks[i] = i + 1
+		if i > 0 && ranked[i].Score == ranked[i-1].Score {
+			ranks[i] = ranks[i-1]
+		}
+	}
+	return ranked, ranks
+}
+
+// buildStandings ranks the players after a question closed. Deltas and previous ranks are
+// relative to the standings of the previous question, which are then replaced by these.
+func (s *Session) buildStandings(questionIndex int) events.StandingsPayload {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	payload := events.StandingsPayload{
+		QuestionIndex: questionIndex,
+		Hidden:        questionIndex >= len(s.questions)-s.hideStandingsQuestions,
+		Standings:     make([]events.Standing, 0, len(s.players)),
+	}
+	for questionID, index := range s.askedQuestions {
+		if index == questionIndex {
+			payload.QuestionID = questionID
+		}
+	}
+
+	ranked, ranks := rankPlayers(s.players)
+	previousScores, previousRanks := s.lastScores, s.lastRanks
+	s.lastScores = make(map[string]int, len(ranked))
+	s.lastRanks = make(map[string]int, len(ranked))
+	for i, player := range ranked {
+		s.lastScores[player.ID] = player.Score
+		s.lastRanks[player.ID] = ranks[i]
+		payload.Standings = append(payload.Standings, events.Standing{
+			Rank:         ranks[i],
+			PreviousRank: previousRanks[player.ID],
+			PlayerID:     player.ID,
+			Name:         player.Name,
+			Score:        player.Score,
+			Delta:        player.Score - previousScores[player.ID],
+			Streak:       player.Streak,
+		})
+	}
+	if payload.Hidden {
+		payload.Standings = []events.Standing{}
+	}
+	return payload
+}
+
+// publishStandings publishes the standings after a question closed. Players who did not answer
+// lose their streak.
+func (s *Session) publishStandings(questionIndex int) {
+	s.mutex.Lock()
+	for id, player := range s.players {
+		if !player.hasVoted {
+			player.Streak = 0
+			s.players[id] = player
+		}
+	}
+	s.mutex.Unlock()
+
+	err := s.publishChannel.Publish(s.ctx, string(events.Standings), s.buildStandings(questionIndex))
+	if err != nil {
+		fmt.Printf("Error publishing standings: %v\n", err)
+	}
+}
@@ -0,0 +1,43 @@
+package quiz_server
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"the-quiz-game/pkg/events"
+)
+
+// Standings must rank ties together and report how each question changed them.
+func TestSession_buildStandings(t *testing.T) {
+	session := NewSession("testSession", SessionConfig{
+		questions:              []Question{{}, {}, {}},
+		hideStandingsQuestions: 1,
+	}, nil, nil, nil, context.Background())
+	session.players = map[string]Player{
+		"1": {ID: "1", Name: "Alice", Score: 1, Streak: 1},
+		"2": {ID: "2", Name: "Bob", Score: 1, Streak: 1},
+		"3": {ID: "3", Name: "Carol", Score: 0},
+	}
+
+	first := session.buildStandings(0)
+	require.False(t, first.Hidden)
+	require.Equal(t, []events.Standing{
+		{Rank: 1, PlayerID: "1", Name: "Alice", Score: 1, Delta: 1, Streak: 1},
+		{Rank: 1, PlayerID: "2", Name: "Bob", Score: 1, Delta: 1, Streak: 1},
+		{Rank: 3, PlayerID: "3", Name: "Carol", Score: 0, Delta: 0},
+	}, first.Standings)
+
+	session.players["2"] = Player{ID: "2", Name: "Bob", Score: 2, Streak: 2}
+	session.players["3"] = Player{ID: "3", Name: "Carol", Score: 1, Streak: 1}
+	second := session.buildStandings(1)
+	require.Equal(t, []events.Standing{
+		{Rank: 1, PreviousRank: 1, PlayerID: "2", Name: "Bob", Score: 2, Delta: 1, Streak: 2},
+		{Rank: 2, PreviousRank: 1, PlayerID: "1", Name: "Alice", Score: 1, Delta: 0, Streak: 1},
+		{Rank: 2, PreviousRank: 3, PlayerID: "3", Name: "Carol", Score: 1, Delta: 1, Streak: 1},
+	}, second.Standings)
+
+	// The final question is hidden to keep the suspense until the scoreboard.
+	last := session.buildStandings(2)
+	require.True(t, last.Hidden)
+	require.Empty(t, last.Standings)
+}
@@ -0,0 +1,97 @@
+// Package signing signs the events the quiz server publishes on realtime channels and verifies
+// them on the client, so anything else publishing on a channel cannot impersonate the server.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Signer signs messages with the server's private key.
+type Signer struct {
+	privateKey ed25519.PrivateKey
+}
+
+func NewSigner(privateKey ed25519.PrivateKey) *Signer {
+	return &Signer{privateKey: privateKey}
+}
+
+// PublicKey returns the base64 encoded public key clients need to verify messages.
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.privateKey.Public().(ed25519.PublicKey))
+}
+
+// Sign returns the base64 encoded signature of message.
+func (s *Signer) Sign(message []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.privateKey, message))
+}
+
+// PublicKey verifies messages signed by a Signer.
+type PublicKey struct {
+	key ed25519.PublicKey
+}
+
+// ParsePublicKey parses the base64 encoded public key handed out by the server.
+func ParsePublicKey(publicKey string) (PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return PublicKey{}, fmt.Errorf("invalid public key")
+	}
+	return PublicKey{key: key}, nil
+}
+
+// Verify reports whether signature is a valid base64 encoded signature of message.
+func (p PublicKey) Verify(message []byte, signature string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(p.key, message, decoded)
+}
+
+// LoadOrCreatePrivateKey reads a PEM encoded private key, generating and saving a new one
+// if the file does not exist yet.
+func LoadOrCreatePrivateKey(path string) (ed25519.PrivateKey, error) {
+	fileContent, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(fileContent)
+		if block == nil {
+			return nil, fmt.Errorf("no PEM data found in %s", path)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s does not contain an ed25519 private key", path)
+		}
+		return privateKey, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, err
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,31 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+// A key saved by LoadOrCreatePrivateKey must load back and verify its own signatures only.
+func TestPublicKey_Verify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	created, err := LoadOrCreatePrivateKey(path)
+	require.NoError(t, err)
+	loaded, err := LoadOrCreatePrivateKey(path)
+	require.NoError(t, err)
+	require.Equal(t, created, loaded)
+
+	signer := NewSigner(loaded)
+	publicKey, err := ParsePublicKey(signer.PublicKey())
+	require.NoError(t, err)
+
+	signature := signer.Sign([]byte("hello"))
+	require.True(t, publicKey.Verify([]byte("hello"), signature))
+	require.False(t, publicKey.Verify([]byte("goodbye"), signature))
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	require.False(t, publicKey.Verify([]byte("hello"), NewSigner(otherKey).Sign([]byte("hello"))))
+}